@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm/clause"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+const TypeRecordEvent = "audit:record"
+
+const (
+	ActionUserRegistered         = "user.registered"
+	ActionEmailVerified          = "user.email_verified"
+	ActionLoginSucceeded         = "auth.login_succeeded"
+	ActionLoginFailed            = "auth.login_failed"
+	ActionLoginDisowned          = "auth.login_disowned"
+	ActionPasswordResetRequested = "auth.password_reset_requested"
+	ActionPasswordResetCompleted = "auth.password_reset_completed"
+)
+
+const TargetUser = "user"
+
+// Event is what happened, who did it and where the request came from.
+// Id and OccurredAt are set when the event is recorded, not when the
+// worker writes it, so a retried task can not write the event twice.
+type Event struct {
+	Id         string
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	IpAddress  string
+	UserAgent  string
+	RequestId  string
+	Metadata   map[string]string
+	OccurredAt time.Time
+}
+
+// Record queues the event for the worker, keeping the write off the
+// request path.
+func Record(client *asynq.Client, event Event) error {
+	event.Id = uuid.New().String()
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeRecordEvent, data)
+
+	_, err = client.Enqueue(task)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	return nil
+}
+
+// HandleRecordEventTask writes a queued event to audit_events.
+func HandleRecordEventTask(ctx context.Context, t *asynq.Task) error {
+	var event Event
+
+	if err := json.Unmarshal(t.Payload(), &event); err != nil {
+		return fmt.Errorf("failed to Unmarshal payload: %w", err)
+	}
+
+	metadata := []byte("{}")
+	if len(event.Metadata) != 0 {
+		var err error
+		if metadata, err = json.Marshal(event.Metadata); err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+	}
+
+	return config.PostDb.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.AuditEvent{
+		Id:         event.Id,
+		ActorId:    event.ActorId,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetId:   event.TargetId,
+		IpAddress:  event.IpAddress,
+		UserAgent:  event.UserAgent,
+		RequestId:  event.RequestId,
+		Metadata:   string(metadata),
+		CreatedAt:  event.OccurredAt,
+	}).Error
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+)
+
+// rotate-keys creates a new signing key for JWT_ALGORITHM and retires the
+// current one. The new key is published at once and takes over signing
+// once cached copies of the jwks have expired; tokens signed with the
+// retired key keep verifying until they expire.
+func main() {
+	if err := config.LoadEnvironmentVariable(); err != nil {
+		fmt.Println("failed to load environment variables:", err)
+		os.Exit(1)
+	}
+
+	if err := config.ConnectPostGres(&config.DbConfig); err != nil {
+		fmt.Println("failed to connect to PostGre:", err)
+		os.Exit(1)
+	}
+
+	key, err := helpers.RotateSigningKey()
+	if err != nil {
+		fmt.Println("failed to rotate signing key:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("new %s signing key: %s, signing from %s\n", key.Algorithm, key.Id, key.ActivatesAt.Format(time.RFC3339))
+}
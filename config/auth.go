@@ -0,0 +1,90 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var AuthConfig AuthEnv
+
+type AuthEnv struct {
+	LoginMaxAttempts     int
+	LoginLockoutDuration time.Duration
+	DeletionGracePeriod  time.Duration
+	// HS256 signs with the app key; RS256 and EdDSA sign with the key
+	// pairs kept in the signing_keys table
+	JwtAlgorithm string
+	// in stateless mode access tokens are verified from their claims alone
+	// and revocation goes through a denylist instead of redis sessions
+	StatelessTokens bool
+}
+
+func loadAuthEnv() error {
+	loginMaxAttempts, exists := os.LookupEnv("LOGIN_MAX_ATTEMPTS")
+	if !exists {
+		return errors.New("LOGIN_MAX_ATTEMPTS not in .env")
+	}
+
+	maxAttempts, err := strconv.Atoi(loginMaxAttempts)
+	if err != nil || maxAttempts < 1 {
+		return errors.New("LOGIN_MAX_ATTEMPTS must be a positive number")
+	}
+
+	loginLockoutMinutes, exists := os.LookupEnv("LOGIN_LOCKOUT_MINUTES")
+	if !exists {
+		return errors.New("LOGIN_LOCKOUT_MINUTES not in .env")
+	}
+
+	lockoutMinutes, err := strconv.Atoi(loginLockoutMinutes)
+	if err != nil || lockoutMinutes < 1 {
+		return errors.New("LOGIN_LOCKOUT_MINUTES must be a positive number")
+	}
+
+	deletionGraceDays, exists := os.LookupEnv("ACCOUNT_DELETION_GRACE_DAYS")
+	if !exists {
+		return errors.New("ACCOUNT_DELETION_GRACE_DAYS not in .env")
+	}
+
+	graceDays, err := strconv.Atoi(deletionGraceDays)
+	if err != nil || graceDays < 0 {
+		return errors.New("ACCOUNT_DELETION_GRACE_DAYS must be a number")
+	}
+
+	jwtAlgorithm, exists := os.LookupEnv("JWT_ALGORITHM")
+	if !exists {
+		return errors.New("JWT_ALGORITHM not in .env")
+	}
+
+	if !slices.Contains([]string{"HS256", "RS256", "EdDSA"}, jwtAlgorithm) {
+		return errors.New("JWT_ALGORITHM must be one of HS256, RS256 or EdDSA")
+	}
+
+	tokenMode, exists := os.LookupEnv("AUTH_TOKEN_MODE")
+	if !exists {
+		return errors.New("AUTH_TOKEN_MODE not in .env")
+	}
+
+	if tokenMode != "session" && tokenMode != "stateless" {
+		return errors.New("AUTH_TOKEN_MODE must be session or stateless")
+	}
+
+	AuthConfig = AuthEnv{
+		LoginMaxAttempts:     maxAttempts,
+		LoginLockoutDuration: time.Minute * time.Duration(lockoutMinutes),
+		DeletionGracePeriod:  time.Hour * 24 * time.Duration(graceDays),
+		JwtAlgorithm:         jwtAlgorithm,
+		StatelessTokens:      tokenMode == "stateless",
+	}
+
+	return nil
+}
+
+// OidcProviderEnabled reports whether we can act as an OpenID Connect
+// provider. Clients verify id tokens themselves, which with HS256 would
+// mean handing every one of them the app key.
+func (a AuthEnv) OidcProviderEnabled() bool {
+	return a.JwtAlgorithm != "HS256"
+}
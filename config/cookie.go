@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var CookieConfig CookieEnv
+
+type CookieEnv struct {
+	Domain   string
+	SameSite http.SameSite
+	// browser origins allowed to send the session cookie cross origin
+	AllowedOrigins []string
+}
+
+func loadCookieEnv() error {
+	domain, exists := os.LookupEnv("AUTH_COOKIE_DOMAIN")
+	if !exists {
+		return errors.New("AUTH_COOKIE_DOMAIN not in .env")
+	}
+
+	sameSiteName, exists := os.LookupEnv("AUTH_COOKIE_SAME_SITE")
+	if !exists {
+		return errors.New("AUTH_COOKIE_SAME_SITE not in .env")
+	}
+
+	var sameSite http.SameSite
+	switch sameSiteName {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		return errors.New("AUTH_COOKIE_SAME_SITE must be lax, strict or none")
+	}
+
+	allowedOrigins, exists := os.LookupEnv("AUTH_COOKIE_ORIGINS")
+	if !exists {
+		return errors.New("AUTH_COOKIE_ORIGINS not in .env")
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(allowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	CookieConfig = CookieEnv{
+		Domain:         domain,
+		SameSite:       sameSite,
+		AllowedOrigins: origins,
+	}
+
+	return nil
+}
@@ -30,6 +30,9 @@ type DB struct {
 	RedisUser   string
 	RedisScheme string
 	RedisAddr   string
+	// run tenant requests in a transaction that sets app.tenant_id for
+	// postgres row level security policies
+	RowLevelSecurity bool
 }
 
 func loadDbEnv() error {
@@ -83,6 +86,11 @@ func loadDbEnv() error {
 		return errors.New("REDIS_SCHEME not in .env")
 	}
 
+	rowLevelSecurity, exists := os.LookupEnv("DB_ROW_LEVEL_SECURITY")
+	if !exists {
+		return errors.New("DB_ROW_LEVEL_SECURITY not in .env")
+	}
+
 	DbConfig = DB{
 		DBName:      dbName,
 		DBPassword:  dBPassword,
@@ -95,6 +103,8 @@ func loadDbEnv() error {
 		RedisUser:   redisUser,
 		RedisScheme: redisScheme,
 		RedisAddr:   fmt.Sprintf("%s:%s", redisHost, redisPort),
+
+		RowLevelSecurity: rowLevelSecurity == "true",
 	}
 
 	return nil
@@ -110,6 +120,10 @@ func ConnectPostGres(cfg *DB) error {
 		return err
 	}
 
+	if err = db.Use(TenantPlugin{}); err != nil {
+		return err
+	}
+
 	PostDb = db
 
 	return nil
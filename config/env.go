@@ -20,5 +20,30 @@ func LoadEnvironmentVariable() error {
 		return err
 	}
 
+	err = loadAuthEnv()
+	if err != nil {
+		return err
+	}
+
+	err = loadOAuthEnv()
+	if err != nil {
+		return err
+	}
+
+	err = loadCookieEnv()
+	if err != nil {
+		return err
+	}
+
+	err = loadWebAuthnEnv()
+	if err != nil {
+		return err
+	}
+
+	err = loadPasswordEnv()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var OAuthConfig OAuthEnv
+
+type OAuthEnv struct {
+	Providers []OAuthProvider
+}
+
+type OAuthProvider struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+}
+
+// OAUTH_PROVIDERS is a comma separated list of provider names; each one
+// reads its settings from OAUTH_<NAME>_ISSUER, _CLIENT_ID and _CLIENT_SECRET
+func loadOAuthEnv() error {
+	providerNames, exists := os.LookupEnv("OAUTH_PROVIDERS")
+	if !exists {
+		return errors.New("OAUTH_PROVIDERS not in .env")
+	}
+
+	var providers []OAuthProvider
+	for _, name := range strings.Split(providerNames, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+		issuer, exists := os.LookupEnv(prefix + "ISSUER")
+		if !exists {
+			return fmt.Errorf("%sISSUER not in .env", prefix)
+		}
+
+		clientId, exists := os.LookupEnv(prefix + "CLIENT_ID")
+		if !exists {
+			return fmt.Errorf("%sCLIENT_ID not in .env", prefix)
+		}
+
+		clientSecret, exists := os.LookupEnv(prefix + "CLIENT_SECRET")
+		if !exists {
+			return fmt.Errorf("%sCLIENT_SECRET not in .env", prefix)
+		}
+
+		providers = append(providers, OAuthProvider{
+			Name:         name,
+			Issuer:       issuer,
+			ClientId:     clientId,
+			ClientSecret: clientSecret,
+		})
+	}
+
+	OAuthConfig = OAuthEnv{
+		Providers: providers,
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var PasswordConfig PasswordEnv
+
+type PasswordEnv struct {
+	MinLength int
+	// character classes every password needs: lower, upper, digit, symbol
+	RequiredClasses []string
+	// 0 to 4, the lowest estimated strength a password may have
+	MinStrength int
+	// directory of hash prefix files, <first 5 sha1 hex>.txt holding
+	// SUFFIX:COUNT lines; empty skips the breached password check
+	BreachedDir string
+}
+
+func loadPasswordEnv() error {
+	passwordMinLength, exists := os.LookupEnv("PASSWORD_MIN_LENGTH")
+	if !exists {
+		return errors.New("PASSWORD_MIN_LENGTH not in .env")
+	}
+
+	minLength, err := strconv.Atoi(passwordMinLength)
+	if err != nil || minLength < 1 || minLength > 72 {
+		return errors.New("PASSWORD_MIN_LENGTH must be a number between 1 and 72")
+	}
+
+	passwordComplexity, exists := os.LookupEnv("PASSWORD_COMPLEXITY")
+	if !exists {
+		return errors.New("PASSWORD_COMPLEXITY not in .env")
+	}
+
+	var classes []string
+	for _, class := range strings.Split(passwordComplexity, ",") {
+		if class = strings.TrimSpace(class); class == "" {
+			continue
+		}
+		if !slices.Contains([]string{"lower", "upper", "digit", "symbol"}, class) {
+			return errors.New("PASSWORD_COMPLEXITY must list lower, upper, digit or symbol")
+		}
+		classes = append(classes, class)
+	}
+
+	passwordMinStrength, exists := os.LookupEnv("PASSWORD_MIN_STRENGTH")
+	if !exists {
+		return errors.New("PASSWORD_MIN_STRENGTH not in .env")
+	}
+
+	minStrength, err := strconv.Atoi(passwordMinStrength)
+	if err != nil || minStrength < 0 || minStrength > 4 {
+		return errors.New("PASSWORD_MIN_STRENGTH must be a number between 0 and 4")
+	}
+
+	breachedDir, exists := os.LookupEnv("PASSWORD_BREACHED_DIR")
+	if !exists {
+		return errors.New("PASSWORD_BREACHED_DIR not in .env")
+	}
+
+	if breachedDir != "" {
+		if info, err := os.Stat(breachedDir); err != nil || !info.IsDir() {
+			return errors.New("PASSWORD_BREACHED_DIR must be a directory")
+		}
+	}
+
+	PasswordConfig = PasswordEnv{
+		MinLength:       minLength,
+		RequiredClasses: classes,
+		MinStrength:     minStrength,
+		BreachedDir:     breachedDir,
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TenantScoped is implemented by models whose rows belong to one tenant.
+// TenantColumn names the column holding the tenant id.
+type TenantScoped interface {
+	TenantColumn() string
+}
+
+type tenantCtxKey string
+
+const (
+	tenantKey   tenantCtxKey = "tenant"
+	tenantTxKey tenantCtxKey = "tenant_tx"
+)
+
+// WithTenant returns a context every query made through TenantDb, or
+// PostDb.WithContext, is scoped to.
+func WithTenant(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantId)
+}
+
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantId, ok := ctx.Value(tenantKey).(string)
+	return tenantId, ok && tenantId != ""
+}
+
+// RunInTenant runs fn with the tenant in its context. With row level
+// security on, fn runs inside a transaction whose app.tenant_id setting is
+// the tenant, so the policies apply to every query made through TenantDb.
+// With it off there is no transaction, fn has to open its own when its
+// writes must land together.
+func RunInTenant(ctx context.Context, tenantId string, fn func(ctx context.Context) error) error {
+	return runWithSetting(WithTenant(ctx, tenantId), "app.tenant_id", tenantId, fn)
+}
+
+// InTenant runs fn with the database handle for the tenant already in
+// ctx, see RunInTenant. The transaction only lasts as long as fn, so mail,
+// redis and other slow work belongs outside of it. An error from fn rolls
+// the transaction back.
+func InTenant(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	tenantId, ok := TenantFromContext(ctx)
+	if !ok {
+		return errors.New("no tenant in context")
+	}
+
+	return RunInTenant(ctx, tenantId, func(ctx context.Context) error {
+		return fn(TenantDb(ctx))
+	})
+}
+
+// RunAsUser runs fn on behalf of the user. With row level security on,
+// its app.user_id setting lets the policies show the user's own
+// memberships and the organizations they belong to.
+func RunAsUser(ctx context.Context, userId string, fn func(ctx context.Context) error) error {
+	return runWithSetting(ctx, "app.user_id", userId, fn)
+}
+
+// RunWithInvitation runs fn for whoever holds the invitation token whose
+// hash is tokenHash. With row level security on, its
+// app.invitation_token_hash setting lets the policies show the invitation
+// and its organization.
+func RunWithInvitation(ctx context.Context, tokenHash string, fn func(ctx context.Context) error) error {
+	return runWithSetting(ctx, "app.invitation_token_hash", tokenHash, fn)
+}
+
+// runWithSetting runs fn in a transaction with the setting for the row
+// level security policies, or straight away with row level security off.
+// Nested calls add their setting to the transaction already open.
+func runWithSetting(ctx context.Context, name, value string, fn func(ctx context.Context) error) error {
+	if !DbConfig.RowLevelSecurity {
+		return fn(ctx)
+	}
+
+	// is_local keeps the setting from outliving the transaction on a
+	// pooled connection
+	if tx, ok := ctx.Value(tenantTxKey).(*gorm.DB); ok {
+		if err := tx.Exec("SELECT set_config(?, ?, true)", name, value).Error; err != nil {
+			return err
+		}
+		return fn(ctx)
+	}
+
+	return PostDb.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT set_config(?, ?, true)", name, value).Error; err != nil {
+			return err
+		}
+		return fn(context.WithValue(ctx, tenantTxKey, tx))
+	})
+}
+
+// TenantDb returns the database handle for the request: the transaction
+// RunInTenant, RunAsUser or RunWithInvitation opened, PostDb bound to ctx
+// otherwise.
+func TenantDb(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(tenantTxKey).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return PostDb.WithContext(ctx)
+}
+
+// TenantPlugin filters reads, updates and deletes of TenantScoped models
+// by the tenant in the statement's context, and stamps it on creates.
+// Statements without a tenant in their context are left alone, as are raw
+// queries.
+type TenantPlugin struct{}
+
+func (TenantPlugin) Name() string {
+	return "tenant"
+}
+
+func (p TenantPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	if err := callback.Create().Before("gorm:create").Register("tenant:create", p.stampTenant); err != nil {
+		return err
+	}
+	if err := callback.Query().Before("gorm:query").Register("tenant:query", p.scopeTenant); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("tenant:update", p.scopeTenant); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("tenant:delete", p.scopeTenant); err != nil {
+		return err
+	}
+	return callback.Row().Before("gorm:row").Register("tenant:row", p.scopeTenant)
+}
+
+func (TenantPlugin) scopeTenant(db *gorm.DB) {
+	column, tenantId, ok := statementTenant(db)
+	if !ok {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: tenantId},
+	}})
+}
+
+func (TenantPlugin) stampTenant(db *gorm.DB) {
+	column, tenantId, ok := statementTenant(db)
+	if !ok {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(column)
+	if field == nil {
+		return
+	}
+
+	value := db.Statement.ReflectValue
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := field.Set(db.Statement.Context, reflect.Indirect(value.Index(i)), tenantId); err != nil {
+				_ = db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(db.Statement.Context, value, tenantId); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+}
+
+func statementTenant(db *gorm.DB) (column, tenantId string, ok bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return "", "", false
+	}
+
+	tenantId, ok = TenantFromContext(db.Statement.Context)
+	if !ok {
+		return "", "", false
+	}
+
+	scoped, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(TenantScoped)
+	if !ok {
+		return "", "", false
+	}
+
+	return scoped.TenantColumn(), tenantId, true
+}
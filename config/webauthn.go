@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+var WebAuthnConfig WebAuthnEnv
+
+type WebAuthnEnv struct {
+	// the domain passkeys are bound to, e.g. example.com
+	RPID string
+	// the frontend origins allowed to run the ceremonies
+	RPOrigins []string
+}
+
+func loadWebAuthnEnv() error {
+	rpId, exists := os.LookupEnv("WEBAUTHN_RP_ID")
+	if !exists {
+		return errors.New("WEBAUTHN_RP_ID not in .env")
+	}
+
+	rpOrigins, exists := os.LookupEnv("WEBAUTHN_RP_ORIGINS")
+	if !exists {
+		return errors.New("WEBAUTHN_RP_ORIGINS not in .env")
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(rpOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	WebAuthnConfig = WebAuthnEnv{
+		RPID:      rpId,
+		RPOrigins: origins,
+	}
+
+	return nil
+}
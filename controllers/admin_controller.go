@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thedevsaddam/govalidator"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	var req request.ListUsers
+	query := r.URL.Query()
+	req.Cursor = query.Get("cursor")
+	req.Limit = query.Get("limit")
+	req.Email = query.Get("email")
+	req.Verified = query.Get("verified")
+	req.CreatedFrom = query.Get("created_from")
+	req.CreatedTo = query.Get("created_to")
+	req.Sort = query.Get("sort")
+
+	rules := govalidator.MapData{
+		"limit":        []string{"numeric_between:1,100"},
+		"email":        []string{"max:255"},
+		"verified":     []string{"in:true,false"},
+		"created_from": []string{"date"},
+		"created_to":   []string{"date"},
+		"sort":         []string{"in:created_at,-created_at,email,-email"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ListUsers(req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.AdminGetUser(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func AdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req request.UpdateUser
+
+	rules := govalidator.MapData{
+		"name":  []string{"alpha_space"},
+		"email": []string{"email"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.AdminUpdateUser(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func DisableUser(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.DisableUser(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func EnableUser(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.EnableUser(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ForceVerifyUser(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.ForceVerifyUser(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.ForcePasswordReset(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thedevsaddam/govalidator"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func GetApiKeys(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.GetApiKeys(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	var req request.CreateApiKey
+
+	rules := govalidator.MapData{
+		"name":       []string{"required", "max:255"},
+		"expires_at": []string{"date"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.CreateApiKey(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func UpdateApiKey(w http.ResponseWriter, r *http.Request) {
+	var req request.UpdateApiKey
+
+	rules := govalidator.MapData{
+		"name": []string{"max:255"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.UpdateApiKey(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func DeleteApiKey(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.DeleteApiKey(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thedevsaddam/govalidator"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	var req request.ListAuditEvents
+	query := r.URL.Query()
+	req.Cursor = query.Get("cursor")
+	req.Limit = query.Get("limit")
+	req.ActorId = query.Get("actor_id")
+	req.Action = query.Get("action")
+	req.TargetType = query.Get("target_type")
+	req.TargetId = query.Get("target_id")
+	req.RequestId = query.Get("request_id")
+	req.From = query.Get("from")
+	req.To = query.Get("to")
+
+	rules := govalidator.MapData{
+		"limit":       []string{"numeric_between:1,100"},
+		"actor_id":    []string{"uuid"},
+		"action":      []string{"max:100"},
+		"target_type": []string{"max:50"},
+		"target_id":   []string{"max:36"},
+		"request_id":  []string{"max:255"},
+		"from":        []string{"date"},
+		"to":          []string{"date"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ListAuditEvents(req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func GetActivity(w http.ResponseWriter, r *http.Request) {
+	var req request.GetActivity
+	query := r.URL.Query()
+	req.Cursor = query.Get("cursor")
+	req.Limit = query.Get("limit")
+
+	rules := govalidator.MapData{
+		"limit": []string{"numeric_between:1,100"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.GetActivity(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
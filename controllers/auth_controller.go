@@ -2,12 +2,15 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/thedevsaddam/govalidator"
 
+	customizedError "github.com/dudeiebot/ad-ly/errors"
 	"github.com/dudeiebot/ad-ly/helpers"
 	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
 	"github.com/dudeiebot/ad-ly/services"
 )
 
@@ -17,7 +20,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	rules := govalidator.MapData{
 		"name":     []string{"required", "alpha_space"},
 		"email":    []string{"required", "email"},
-		"password": []string{"regex:^.{8,}", "required"},
+		"password": []string{"required"},
 	}
 
 	opt := govalidator.Options{
@@ -33,9 +36,15 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err, status := services.RegisterUser(req)
+	resp, err, status := services.RegisterUser(req, helpers.DeviceFromRequest(r))
 
 	if err != nil {
+		var policyErr helpers.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			helpers.ReturnValidatorErrors(w, policyErr.ValidationErrors())
+			return
+		}
+
 		w.WriteHeader(status)
 		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
 		return
@@ -67,7 +76,74 @@ func VerifyUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err, status := services.VerifyUser(req.Token)
+	resp, err, status := services.VerifyUser(req.Token, helpers.DeviceFromRequest(r))
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req request.ResendVerification
+
+	rules := govalidator.MapData{
+		"email": []string{"required", "email"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ResendVerification(req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func VerifyCode(w http.ResponseWriter, r *http.Request) {
+	var req request.VerifyCode
+
+	rules := govalidator.MapData{
+		"email": []string{"required", "email"},
+		"code":  []string{"required", "digits:6"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.VerifyCode(req, helpers.DeviceFromRequest(r))
+
 	if err != nil {
 		w.WriteHeader(status)
 		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
@@ -100,7 +176,44 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err, status := services.LoginUser(req)
+	resp, err, status := services.LoginUser(req, helpers.DeviceFromRequest(r))
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	if resp.Token != "" {
+		helpers.SetAuthCookies(w, resp.Token, resp.RefreshToken)
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func SendMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req request.MagicLink
+
+	rules := govalidator.MapData{
+		"email": []string{"required", "email"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.SendMagicLink(req)
 
 	if err != nil {
 		w.WriteHeader(status)
@@ -113,6 +226,159 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req request.ConsumeMagicLink
+	req.Token = r.URL.Query().Get("token")
+
+	rules := govalidator.MapData{
+		"token": []string{"required", "alpha_num"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ConsumeMagicLink(req.Token, helpers.DeviceFromRequest(r))
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	if resp.Token != "" {
+		helpers.SetAuthCookies(w, resp.Token, resp.RefreshToken)
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	var req request.UnlockAccount
+	req.Token = r.URL.Query().Get("token")
+
+	rules := govalidator.MapData{
+		"token": []string{"required", "alpha_num"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.UnlockAccount(req.Token)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func DisownLogin(w http.ResponseWriter, r *http.Request) {
+	var req request.DisownLogin
+	req.Token = r.URL.Query().Get("token")
+
+	rules := govalidator.MapData{
+		"token": []string{"required", "alpha_num"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.DisownLogin(req.Token, helpers.DeviceFromRequest(r))
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req request.RefreshToken
+
+	// browser clients send the refresh token as a cookie instead
+	if cookie, err := r.Cookie(helpers.RefreshTokenCookie); err == nil && r.ContentLength == 0 {
+		if !helpers.ValidCsrf(r) {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(helpers.Message(customizedError.ErrInvalidCsrfToken.Error()))
+			return
+		}
+		req.RefreshToken = cookie.Value
+	} else {
+		rules := govalidator.MapData{
+			"refresh_token": []string{"required"},
+		}
+
+		opts := govalidator.Options{
+			Rules:   rules,
+			Request: r,
+			Data:    &req,
+		}
+
+		validationErrors := helpers.ValidateRequest(opts, "json")
+
+		if len(validationErrors) != 0 {
+			helpers.ReturnValidatorErrors(w, validationErrors)
+			return
+		}
+	}
+
+	resp, err, status := services.RefreshToken(req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	if resp.Token != "" {
+		helpers.SetAuthCookies(w, resp.Token, resp.RefreshToken)
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
 func ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	var req request.ForgotPassword
 
@@ -131,7 +397,7 @@ func ForgotPassword(w http.ResponseWriter, r *http.Request) {
 		helpers.ReturnValidatorErrors(w, validationErrors)
 	}
 
-	resp, err, status := services.ForgotPassword(req)
+	resp, err, status := services.ForgotPassword(req, helpers.DeviceFromRequest(r))
 
 	if err != nil {
 		w.WriteHeader(status)
@@ -149,7 +415,7 @@ func PostForgot(w http.ResponseWriter, r *http.Request) {
 	req.Token = r.URL.Query().Get("token")
 
 	rules := govalidator.MapData{
-		"password": []string{"regex:^.{8,}", "required"},
+		"password": []string{"required"},
 		"token":    []string{"required", "uuid"},
 	}
 
@@ -164,7 +430,59 @@ func PostForgot(w http.ResponseWriter, r *http.Request) {
 		helpers.ReturnValidatorErrors(w, validationErrors)
 	}
 
-	resp, err, status := services.PostForgot(req)
+	resp, err, status := services.PostForgot(req, helpers.DeviceFromRequest(r))
+
+	if err != nil {
+		var policyErr helpers.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			helpers.ReturnValidatorErrors(w, policyErr.ValidationErrors())
+			return
+		}
+
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+// Csrf issues the token browser clients authenticated by cookie have to
+// send back in the X-CSRF-Token header on state changing requests.
+func Csrf(w http.ResponseWriter, r *http.Request) {
+	token, err := helpers.IssueCsrfToken(w)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(helpers.Message(helpers.ServerError(err).Error()))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(responses.CsrfResponse{CsrfToken: token})
+	return
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.Logout(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	helpers.ClearAuthCookies(w)
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.LogoutAll(r)
 
 	if err != nil {
 		w.WriteHeader(status)
@@ -172,6 +490,8 @@ func PostForgot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	helpers.ClearAuthCookies(w)
+
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(resp)
 	return
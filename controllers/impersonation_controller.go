@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thedevsaddam/govalidator"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func StartImpersonation(w http.ResponseWriter, r *http.Request) {
+	var req request.StartImpersonation
+
+	rules := govalidator.MapData{
+		"reason": []string{"required", "max:500"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.StartImpersonation(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func StopImpersonation(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.StopImpersonation(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func GetImpersonations(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.GetImpersonations(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thedevsaddam/govalidator"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func SetupMfa(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.SetupMfa(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ConfirmMfa(w http.ResponseWriter, r *http.Request) {
+	var req request.ConfirmMfa
+
+	rules := govalidator.MapData{
+		"code": []string{"required", "digits:6"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ConfirmMfa(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func DisableMfa(w http.ResponseWriter, r *http.Request) {
+	var req request.DisableMfa
+
+	rules := govalidator.MapData{
+		"password": []string{"required"},
+		"code":     []string{"required"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.DisableMfa(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func VerifyMfa(w http.ResponseWriter, r *http.Request) {
+	var req request.VerifyMfa
+
+	rules := govalidator.MapData{
+		"mfa_token": []string{"required", "uuid"},
+		"code":      []string{"required"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.VerifyMfa(req, helpers.DeviceFromRequest(r))
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	if resp.Token != "" {
+		helpers.SetAuthCookies(w, resp.Token, resp.RefreshToken)
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
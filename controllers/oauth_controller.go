@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/responses"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func StartOAuth(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.StartOAuth(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	helpers.SetOAuthStateCookie(w, resp.State)
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.OAuthCallback(r)
+
+	// the state is spent either way
+	helpers.ClearOAuthStateCookie(w)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	if auth, ok := resp.(responses.AuthResponse); ok && auth.Token != "" {
+		helpers.SetAuthCookies(w, auth.Token, auth.RefreshToken)
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func LinkOAuth(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.LinkOAuth(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	helpers.SetOAuthStateCookie(w, resp.State)
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func GetLinkedIdentities(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.GetLinkedIdentities(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(helpers.Response("identities", resp))
+	return
+}
+
+func UnlinkOAuth(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.UnlinkOAuth(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
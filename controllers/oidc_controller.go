@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/thedevsaddam/govalidator"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func OpenIdConfiguration(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.GetOpenIdConfiguration()
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func JsonWebKeys(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.GetJsonWebKeys()
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(helpers.JwksMaxAge.Seconds())))
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func Authorize(w http.ResponseWriter, r *http.Request) {
+	var req request.Authorize
+	query := r.URL.Query()
+	req.ClientId = query.Get("client_id")
+	req.RedirectUri = query.Get("redirect_uri")
+	req.ResponseType = query.Get("response_type")
+	req.Scope = query.Get("scope")
+	req.State = query.Get("state")
+	req.Nonce = query.Get("nonce")
+	req.CodeChallenge = query.Get("code_challenge")
+	req.CodeChallengeMethod = query.Get("code_challenge_method")
+
+	rules := govalidator.MapData{
+		"client_id":             []string{"required"},
+		"redirect_uri":          []string{"required", "url"},
+		"response_type":         []string{"required"},
+		"code_challenge_method": []string{"in:S256"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.Authorize(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+// Token takes a form encoded body, as the spec requires, and answers
+// errors in the oauth format rather than our usual message.
+func Token(w http.ResponseWriter, r *http.Request) {
+	var req request.Token
+	req.GrantType = r.PostFormValue("grant_type")
+	req.Code = r.PostFormValue("code")
+	req.RedirectUri = r.PostFormValue("redirect_uri")
+	req.CodeVerifier = r.PostFormValue("code_verifier")
+	req.ClientId = r.PostFormValue("client_id")
+	req.ClientSecret = r.PostFormValue("client_secret")
+	req.Scope = r.PostFormValue("scope")
+
+	rules := govalidator.MapData{
+		"grant_type": []string{"required"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.Token(r, req)
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(responses.GenerateOAuthError(err))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func UserInfo(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.UserInfo(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/services"
+)
+
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.GetSessions(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(helpers.Response("sessions", resp))
+	return
+}
+
+func DeleteSession(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.DeleteSession(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
@@ -2,9 +2,13 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/thedevsaddam/govalidator"
+
 	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/request"
 	"github.com/dudeiebot/ad-ly/services"
 )
 
@@ -21,3 +25,172 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 	return
 }
+
+func GetVerificationStatus(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.GetVerificationStatus(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req request.ChangePassword
+
+	rules := govalidator.MapData{
+		"current_password": []string{"required"},
+		"password":         []string{"required"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ChangePassword(r, req)
+
+	if err != nil {
+		var policyErr helpers.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			helpers.ReturnValidatorErrors(w, policyErr.ValidationErrors())
+			return
+		}
+
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req request.ChangeEmail
+
+	rules := govalidator.MapData{
+		"email":    []string{"required", "email"},
+		"password": []string{"required"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ChangeEmail(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req request.ConfirmEmailChange
+	req.Token = r.URL.Query().Get("token")
+
+	rules := govalidator.MapData{
+		"token": []string{"required", "alpha_num"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "query")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.ConfirmEmailChange(req.Token)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	var req request.DeleteUser
+
+	rules := govalidator.MapData{
+		"password": []string{"required"},
+	}
+
+	opts := govalidator.Options{
+		Rules:   rules,
+		Request: r,
+		Data:    &req,
+	}
+
+	validationErrors := helpers.ValidateRequest(opts, "json")
+
+	if len(validationErrors) != 0 {
+		helpers.ReturnValidatorErrors(w, validationErrors)
+		return
+	}
+
+	resp, err, status := services.DeleteUser(r, req)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
+
+func ExportUser(w http.ResponseWriter, r *http.Request) {
+	resp, err, status := services.ExportUser(r)
+
+	if err != nil {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(helpers.Message(err.Error()))
+		return
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+	return
+}
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'oauth_clients:manage';
+
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS impersonations (
+    id VARCHAR(36) PRIMARY KEY,
+    actor_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    session_id VARCHAR(36) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonations_actor_id ON impersonations (actor_id);
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations (user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonations_session_id ON impersonations (session_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Act as another user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions
+WHERE roles.name = 'admin' AND permissions.name = 'users:impersonate'
+ON CONFLICT DO NOTHING;
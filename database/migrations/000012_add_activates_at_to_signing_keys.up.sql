@@ -0,0 +1,3 @@
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS activates_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE signing_keys SET activates_at = created_at;
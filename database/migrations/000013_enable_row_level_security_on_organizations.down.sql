@@ -0,0 +1,7 @@
+DROP POLICY IF EXISTS tenant_isolation ON organizations;
+DROP POLICY IF EXISTS tenant_isolation ON invitations;
+DROP POLICY IF EXISTS tenant_isolation ON memberships;
+
+ALTER TABLE invitations DISABLE ROW LEVEL SECURITY;
+ALTER TABLE memberships DISABLE ROW LEVEL SECURITY;
+ALTER TABLE organizations DISABLE ROW LEVEL SECURITY;
@@ -0,0 +1,40 @@
+-- only enforced for roles that neither own the tables nor bypass row level
+-- security, see DB_ROW_LEVEL_SECURITY
+ALTER TABLE organizations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE memberships ENABLE ROW LEVEL SECURITY;
+ALTER TABLE invitations ENABLE ROW LEVEL SECURITY;
+
+-- a tenant request sees its organization's memberships, a user their own
+DROP POLICY IF EXISTS tenant_isolation ON memberships;
+CREATE POLICY tenant_isolation ON memberships
+    USING (
+        organization_id = current_setting('app.tenant_id', true)
+        OR user_id = current_setting('app.user_id', true)
+    );
+
+-- a tenant request sees its organization's invitations, the holder of a
+-- token the invitation it was emailed with
+DROP POLICY IF EXISTS tenant_isolation ON invitations;
+CREATE POLICY tenant_isolation ON invitations
+    USING (
+        organization_id = current_setting('app.tenant_id', true)
+        OR token_hash = current_setting('app.invitation_token_hash', true)
+    );
+
+-- an organization is visible to its tenant, its members and whoever holds
+-- one of its invitations
+DROP POLICY IF EXISTS tenant_isolation ON organizations;
+CREATE POLICY tenant_isolation ON organizations
+    USING (
+        id = current_setting('app.tenant_id', true)
+        OR EXISTS (
+            SELECT 1 FROM memberships
+            WHERE memberships.organization_id = organizations.id
+                AND memberships.user_id = current_setting('app.user_id', true)
+        )
+        OR EXISTS (
+            SELECT 1 FROM invitations
+            WHERE invitations.organization_id = organizations.id
+                AND invitations.token_hash = current_setting('app.invitation_token_hash', true)
+        )
+    );
@@ -0,0 +1,5 @@
+ALTER TABLE impersonations ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+UPDATE impersonations SET expires_at = started_at + INTERVAL '30 days' WHERE expires_at IS NULL;
+
+ALTER TABLE impersonations ALTER COLUMN expires_at SET NOT NULL;
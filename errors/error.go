@@ -7,5 +7,65 @@ var (
 	ErrSomethingWentWrong       = errors.New("Something went wrong")
 	ErrInvalidCredentials       = errors.New("Invalid Credentials")
 	ErrEmailNotVerified         = errors.New("Email Not Verified")
+	ErrAccountDisabled          = errors.New("Account Disabled")
+	ErrAccountLocked            = errors.New("Account Locked, Check Your Email To Unlock It")
+	ErrTooManyLoginAttempts     = errors.New("Too Many Login Attempts, Try Again Later")
+	ErrInvalidUnlockToken       = errors.New("Invalid Or Expired Unlock Token")
+	ErrInvalidEmailChange       = errors.New("Invalid Or Expired Email Change Link")
+	ErrSameEmail                = errors.New("New Email Must Be Different")
+	ErrUnknownOAuthProvider     = errors.New("Unknown OAuth Provider")
+	ErrInvalidOAuthState        = errors.New("Invalid Or Expired OAuth State")
+	ErrOAuthEmailNotVerified    = errors.New("Provider Did Not Return A Verified Email")
+	ErrIdentityAlreadyLinked    = errors.New("Identity Already Linked To Another Account")
+	ErrIdentityNotLinked        = errors.New("Provider Not Linked")
+	ErrLastSignInMethod         = errors.New("Set A Password Or Add A Passkey Before Unlinking Your Last Provider")
+	ErrUserNotFound             = errors.New("User Not Found")
+	ErrInvalidCursor            = errors.New("Invalid Cursor")
 	ErrCantSendVerificationMail = errors.New("Cant Resend Verification Mail")
+	ErrInvalidVerificationCode  = errors.New("Invalid Or Expired Verification Code")
+	ErrTooManyCodeGuesses       = errors.New("Too Many Wrong Codes, Use The Link In Your Email Instead")
+	ErrEmailAlreadyVerified     = errors.New("Email Already Verified")
+	ErrCantSendMagicLink        = errors.New("Cant Resend Magic Link")
+	ErrCantRequestDataExport    = errors.New("Data Export Already Requested")
+	ErrInvalidMagicLink         = errors.New("Invalid Or Expired Magic Link")
+	ErrInvalidRefreshToken      = errors.New("Invalid Refresh Token")
+	ErrRefreshTokenReused       = errors.New("Refresh Token Reused, Please Login Again")
+	ErrSessionNotFound          = errors.New("Session Not Found")
+	ErrInvalidMfaChallenge      = errors.New("Invalid Or Expired Mfa Challenge")
+	ErrInvalidMfaCode           = errors.New("Invalid Mfa Code")
+	ErrMfaAlreadyEnabled        = errors.New("Two Factor Already Enabled")
+	ErrMfaNotEnabled            = errors.New("Two Factor Not Enabled")
+	ErrMfaSetupNotStarted       = errors.New("Two Factor Setup Not Started")
+	ErrOAuthClientNotFound      = errors.New("OAuth Client Not Found")
+	ErrInvalidClient            = errors.New("Invalid Client")
+	ErrInvalidRedirectUri       = errors.New("Invalid Redirect Uri")
+	ErrInvalidScope             = errors.New("Invalid Scope")
+	ErrInvalidGrant             = errors.New("Invalid Or Expired Authorization Code")
+	ErrOidcProviderDisabled     = errors.New("Id Tokens Need An Asymmetric JWT_ALGORITHM")
+	ErrUnauthorizedClient       = errors.New("Grant Type Not Allowed For Client")
+	ErrUnsupportedGrantType     = errors.New("Unsupported Grant Type")
+	ErrUnsupportedResponseType  = errors.New("Unsupported Response Type")
+	ErrCodeChallengeRequired    = errors.New("Code Challenge Required")
+	ErrInvalidAccessToken       = errors.New("Invalid Access Token")
+	ErrInvalidCsrfToken         = errors.New("Invalid Csrf Token")
+	ErrApiKeyNotFound           = errors.New("Api Key Not Found")
+	ErrInvalidApiKeyScope       = errors.New("Invalid Api Key Scope")
+	ErrInvalidApiKeyExpiry      = errors.New("Api Key Expiry Must Be In The Future")
+	ErrInvalidPasskeyChallenge  = errors.New("Invalid Or Expired Passkey Challenge")
+	ErrInvalidPasskey           = errors.New("Invalid Passkey")
+	ErrPasskeyNotFound          = errors.New("Passkey Not Found")
+	ErrImpersonationForbidden   = errors.New("Not Allowed While Impersonating")
+	ErrCantImpersonate          = errors.New("Cant Impersonate This User")
+	ErrNotImpersonating         = errors.New("Not Impersonating")
+	ErrForbidden                = errors.New("Forbidden")
+	ErrOrganizationNotFound     = errors.New("Organization Not Found")
+	ErrMemberNotFound           = errors.New("Member Not Found")
+	ErrAlreadyMember            = errors.New("Already A Member")
+	ErrInvalidInvitation        = errors.New("Invalid Or Expired Invitation")
+	ErrInvitationNotFound       = errors.New("Invitation Not Found")
+	ErrInvitationEmailMismatch  = errors.New("Invitation Was Sent To Another Email")
+	ErrInvalidOrgRole           = errors.New("Invalid Organization Role")
+	ErrCantRemoveOwner          = errors.New("Transfer Ownership Before Removing The Owner")
+	ErrOwnsOrganization         = errors.New("Transfer Ownership Of Your Organizations First")
+	ErrInvalidLoginAlert        = errors.New("Invalid Or Expired Sign In Alert Link")
 )
@@ -2,51 +2,413 @@ package helpers
 
 import (
 	"context"
-	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/models"
 )
 
-func GenerateAccessToken(ctx context.Context, userId string) (token string, err error) {
-	tokenStore := uuid.New().String()
-	tokenExpiry := time.Hour * 24
+const (
+	AccessTokenExpiry  = time.Minute * 15
+	RefreshTokenExpiry = time.Hour * 24 * 30
 
-	err = config.Redis.Set(ctx, "user_auth_"+tokenStore, userId, tokenExpiry).Err()
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+)
+
+type AuthToken struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+	// the token family both tokens belong to
+	SessionId string
+}
+
+type AccessClaims struct {
+	TokenId   string
+	UserId    string
+	SessionId string
+	// the admin acting as UserId, empty unless impersonating
+	ActorId string
+}
+
+type Session struct {
+	Id         string
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// set when an admin opened the session to act as the user
+	ActorId string
+}
+
+// GenerateAccessToken starts a new token family for the user and issues
+// its first access/refresh token pair. The family doubles as the session
+// shown to the user, so the device it was issued to is recorded with it.
+func GenerateAccessToken(ctx context.Context, userId string, device Device) (AuthToken, error) {
+	return startTokenFamily(ctx, userId, "", device)
+}
+
+// GenerateImpersonationToken starts a token family for the user on behalf
+// of actorId. Every token in it carries the actor in an act claim, and
+// refreshing keeps it.
+func GenerateImpersonationToken(ctx context.Context, userId, actorId string, device Device) (AuthToken, error) {
+	return startTokenFamily(ctx, userId, actorId, device)
+}
+
+func startTokenFamily(ctx context.Context, userId, actorId string, device Device) (AuthToken, error) {
+	familyId := uuid.New().String()
+	now := time.Now().Unix()
+
+	sessionKey := "user_session_" + familyId
+
+	_, err := config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKey,
+			"user_agent", device.UserAgent,
+			"ip_address", device.IpAddress,
+			"actor_id", actorId,
+			"created_at", now,
+			"last_seen_at", now,
+		)
+		pipe.Expire(ctx, sessionKey, RefreshTokenExpiry)
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return AuthToken{}, err
 	}
 
-	auth := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"exp":   time.Now().Add(tokenExpiry).Unix(),
-		"token": tokenStore,
+	return issueTokens(ctx, userId, actorId, familyId)
+}
+
+// every token issued from one login shares a family, so replaying a
+// refresh token that was already rotated can take the whole family down
+func issueTokens(ctx context.Context, userId, actorId, familyId string) (AuthToken, error) {
+	accessStore := uuid.New().String()
+	refreshStore := uuid.New().String()
+
+	accessKey := "user_auth_" + accessStore
+	refreshKey := "user_refresh_" + refreshStore
+	familyKey := "token_family_" + familyId
+	sessionKey := "user_session_" + familyId
+	sessionsKey := "user_sessions_" + userId
+
+	_, err := config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, accessKey, "user_id", userId, "family_id", familyId, "actor_id", actorId)
+		pipe.Expire(ctx, accessKey, AccessTokenExpiry)
+		pipe.HSet(ctx, refreshKey, "user_id", userId, "family_id", familyId, "actor_id", actorId)
+		pipe.Expire(ctx, refreshKey, RefreshTokenExpiry)
+		pipe.SAdd(ctx, familyKey, accessKey, refreshKey)
+		pipe.Expire(ctx, familyKey, RefreshTokenExpiry)
+		pipe.HSet(ctx, sessionKey, "last_seen_at", time.Now().Unix())
+		pipe.Expire(ctx, sessionKey, RefreshTokenExpiry)
+		pipe.SAdd(ctx, sessionsKey, familyId)
+		pipe.Expire(ctx, sessionsKey, RefreshTokenExpiry)
+		return nil
 	})
+	if err != nil {
+		return AuthToken{}, err
+	}
+
+	// the subject and session let stateless verification skip redis
+	accessClaims := jwt.MapClaims{
+		"sub": userId,
+		"sid": familyId,
+	}
+	if actorId != "" {
+		accessClaims["act"] = map[string]string{"sub": actorId}
+	}
 
-	token, err = auth.SignedString([]byte(config.AppConfig.AppKey))
+	accessToken, err := signToken(accessStore, accessTokenType, AccessTokenExpiry, accessClaims)
 	if err != nil {
-		return "", err
+		return AuthToken{}, err
 	}
 
-	return token, nil
+	refreshToken, err := signToken(refreshStore, refreshTokenType, RefreshTokenExpiry, jwt.MapClaims{})
+	if err != nil {
+		return AuthToken{}, err
+	}
+
+	return AuthToken{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenExpiry.Seconds()),
+		SessionId:    familyId,
+	}, nil
 }
 
-func ParseAccessToken(token string) (string, error) {
-	var tempToken string
+// RotateRefreshToken exchanges a refresh token for a new token pair in the
+// same family. A refresh token can only be used once; presenting it again
+// revokes every token in its family.
+func RotateRefreshToken(ctx context.Context, refreshToken string) (AuthToken, string, error) {
+	refreshStore := parseToken(refreshToken, refreshTokenType)
+	if refreshStore == "" {
+		return AuthToken{}, "", errors.ErrInvalidRefreshToken
+	}
+
+	refreshKey := "user_refresh_" + refreshStore
+
+	session, err := config.Redis.HGetAll(ctx, refreshKey).Result()
+	if err != nil {
+		return AuthToken{}, "", err
+	}
+	if session["user_id"] == "" {
+		return AuthToken{}, "", errors.ErrInvalidRefreshToken
+	}
+
+	fresh, err := config.Redis.HSetNX(ctx, refreshKey, "used_at", time.Now().Unix()).Result()
+	if err != nil {
+		return AuthToken{}, "", err
+	}
+	if !fresh {
+		if err = RevokeTokenFamily(ctx, session["user_id"], session["family_id"]); err != nil {
+			return AuthToken{}, "", err
+		}
+		return AuthToken{}, "", errors.ErrRefreshTokenReused
+	}
 
-	validation, _ := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	token, err := issueTokens(ctx, session["user_id"], session["actor_id"], session["family_id"])
+	if err != nil {
+		return AuthToken{}, "", err
+	}
+
+	// the new refresh token keeps an impersonation going for longer
+	if session["actor_id"] != "" {
+		err = config.PostDb.Model(&models.Impersonation{}).
+			Where("session_id = ? AND ended_at IS NULL", session["family_id"]).
+			Update("expires_at", time.Now().Add(RefreshTokenExpiry)).Error
+		if err != nil {
+			return AuthToken{}, "", err
 		}
+	}
 
-		return []byte(config.AppConfig.AppKey), nil
+	return token, session["user_id"], nil
+}
+
+// RevokeTokenFamily deletes every access and refresh token issued to one
+// login session and drops it from the user's session index. Its access
+// tokens are denylisted too, since stateless verification never looks at
+// the deleted keys. An impersonation running in the session ends with it.
+func RevokeTokenFamily(ctx context.Context, userId, familyId string) error {
+	familyKey := "token_family_" + familyId
+	sessionKey := "user_session_" + familyId
+
+	keys, err := config.Redis.SMembers(ctx, familyKey).Result()
+	if err != nil {
+		return err
+	}
+
+	actorId, err := config.Redis.HGet(ctx, sessionKey, "actor_id").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	var accessStores []string
+	for _, key := range keys {
+		if accessStore, ok := strings.CutPrefix(key, "user_auth_"); ok {
+			accessStores = append(accessStores, accessStore)
+		}
+	}
+	if err = DenyTokens(ctx, accessStores...); err != nil {
+		return err
+	}
+
+	_, err = config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, append(keys, familyKey, sessionKey)...)
+		pipe.SRem(ctx, "user_sessions_"+userId, familyId)
+		return nil
 	})
+	if err != nil || actorId == "" {
+		return err
+	}
+
+	// however the session was cut off, the impersonation ran in it ends with it
+	return config.PostDb.Model(&models.Impersonation{}).
+		Where("session_id = ? AND ended_at IS NULL", familyId).
+		Update("ended_at", time.Now()).Error
+}
+
+// RevokeUserTokens revokes every session the user currently has open.
+func RevokeUserTokens(ctx context.Context, userId string) error {
+	sessionsKey := "user_sessions_" + userId
+
+	familyIds, err := config.Redis.SMembers(ctx, sessionsKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, familyId := range familyIds {
+		if err = RevokeTokenFamily(ctx, userId, familyId); err != nil {
+			return err
+		}
+	}
+
+	return config.Redis.Del(ctx, sessionsKey).Err()
+}
+
+// RevokeOtherSessions revokes every session of the user except the one
+// identified by keepFamilyId.
+func RevokeOtherSessions(ctx context.Context, userId, keepFamilyId string) error {
+	familyIds, err := config.Redis.SMembers(ctx, "user_sessions_"+userId).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, familyId := range familyIds {
+		if familyId == keepFamilyId {
+			continue
+		}
+		if err = RevokeTokenFamily(ctx, userId, familyId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListUserSessions returns the sessions the user is currently signed in with.
+func ListUserSessions(ctx context.Context, userId string) ([]Session, error) {
+	sessionsKey := "user_sessions_" + userId
+
+	familyIds, err := config.Redis.SMembers(ctx, sessionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(familyIds))
+	for _, familyId := range familyIds {
+		meta, err := config.Redis.HGetAll(ctx, "user_session_"+familyId).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		// the session has expired since it was indexed
+		if len(meta) == 0 {
+			_ = config.Redis.SRem(ctx, sessionsKey, familyId).Err()
+			continue
+		}
+
+		createdAt, _ := strconv.ParseInt(meta["created_at"], 10, 64)
+		lastSeenAt, _ := strconv.ParseInt(meta["last_seen_at"], 10, 64)
+
+		sessions = append(sessions, Session{
+			Id:         familyId,
+			UserAgent:  meta["user_agent"],
+			IpAddress:  meta["ip_address"],
+			ActorId:    meta["actor_id"],
+			CreatedAt:  time.Unix(createdAt, 0),
+			LastSeenAt: time.Unix(lastSeenAt, 0),
+		})
+	}
+
+	return sessions, nil
+}
+
+func HasSession(ctx context.Context, userId, familyId string) (bool, error) {
+	return config.Redis.SIsMember(ctx, "user_sessions_"+userId, familyId).Result()
+}
+
+func TouchSession(ctx context.Context, familyId string, device Device) error {
+	sessionKey := "user_session_" + familyId
+
+	exists, err := config.Redis.Exists(ctx, sessionKey).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+
+	return config.Redis.HSet(ctx, sessionKey,
+		"ip_address", device.IpAddress,
+		"last_seen_at", time.Now().Unix(),
+	).Err()
+}
+
+func ParseAccessToken(token string) (string, error) {
+	return parseToken(token, accessTokenType), nil
+}
+
+// RequestUserId returns the user whose access token the request carries,
+// in the Authorization header or the access_token cookie, and "" when it
+// carries no valid one. Unlike AuthenticateUser it never turns the
+// request away, for routes anonymous callers reach too.
+func RequestUserId(r *http.Request) string {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		if cookie, err := r.Cookie(AccessTokenCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return ""
+	}
+
+	if config.AuthConfig.StatelessTokens {
+		claims, err := ParseStatelessAccessToken(r.Context(), token)
+		if err != nil {
+			return ""
+		}
+		return claims.UserId
+	}
+
+	tempToken, _ := ParseAccessToken(token)
+	if tempToken == "" {
+		return ""
+	}
+
+	userId, _ := config.Redis.HGet(r.Context(), "user_auth_"+tempToken, "user_id").Result()
+	return userId
+}
+
+// ParseStatelessAccessToken verifies an access token from its signature
+// and claims alone, only asking the denylist whether it was revoked.
+func ParseStatelessAccessToken(ctx context.Context, token string) (AccessClaims, error) {
+	claims, err := ParseClaims(token)
+	if err != nil || claims["typ"] != accessTokenType {
+		return AccessClaims{}, errors.ErrInvalidAccessToken
+	}
+
+	accessClaims := AccessClaims{}
+	accessClaims.TokenId, _ = claims["token"].(string)
+	accessClaims.UserId, _ = claims["sub"].(string)
+	accessClaims.SessionId, _ = claims["sid"].(string)
+	if actor, ok := claims["act"].(map[string]interface{}); ok {
+		accessClaims.ActorId, _ = actor["sub"].(string)
+	}
+	if accessClaims.TokenId == "" || accessClaims.UserId == "" {
+		return AccessClaims{}, errors.ErrInvalidAccessToken
+	}
+
+	denied, err := IsTokenDenied(ctx, accessClaims.TokenId)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	if denied {
+		return AccessClaims{}, errors.ErrInvalidAccessToken
+	}
+
+	return accessClaims, nil
+}
+
+func signToken(tokenStore, tokenType string, expiry time.Duration, claims jwt.MapClaims) (string, error) {
+	claims["exp"] = time.Now().Add(expiry).Unix()
+	claims["token"] = tokenStore
+	claims["typ"] = tokenType
+
+	return SignClaims(claims)
+}
 
-	if claims, ok := validation.Claims.(jwt.MapClaims); ok && validation.Valid {
-		tempToken, _ = claims["token"].(string)
+func parseToken(token, tokenType string) string {
+	claims, err := ParseClaims(token)
+	if err != nil || claims["typ"] != tokenType {
+		return ""
 	}
 
-	return tempToken, nil
+	tempToken, _ := claims["token"].(string)
+	return tempToken
 }
@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	ApiKeyHeader = "X-API-Key"
+
+	apiKeyPrefix = "adly_"
+)
+
+// GenerateApiKey returns a key of the form adly_<id>_<secret>. Only the
+// prefix, adly_<id>, and a hash of the secret are meant to be stored.
+func GenerateApiKey() (key, prefix, secretHash string, err error) {
+	id, err := generateAlphaNumericToken(8)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	secret, err := generateAlphaNumericToken(40)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	prefix = apiKeyPrefix + id
+
+	return prefix + "_" + secret, prefix, HashApiKeySecret(secret), nil
+}
+
+// SplitApiKey separates a presented key into its lookup prefix and secret.
+func SplitApiKey(key string) (prefix, secret string, ok bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", "", false
+	}
+
+	index := strings.LastIndex(key, "_")
+	if index <= len(apiKeyPrefix) || index == len(key)-1 {
+		return "", "", false
+	}
+
+	return key[:index], key[index+1:], true
+}
+
+// the secret is long and random, so a fast hash is enough here unlike for
+// passwords
+func HashApiKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func ApiKeySecretMatches(secret, secretHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashApiKeySecret(secret)), []byte(secretHash)) == 1
+}
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/dudeiebot/ad-ly/config"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CsrfCookie         = "csrf_token"
+	CsrfHeader         = "X-CSRF-Token"
+
+	refreshCookiePath = "/auth/refresh"
+)
+
+// SetAuthCookies hands the tokens to browser clients as HttpOnly cookies,
+// so they never have to keep them in script reachable storage. The refresh
+// token is only ever sent to the refresh endpoint.
+func SetAuthCookies(w http.ResponseWriter, accessToken, refreshToken string) {
+	http.SetCookie(w, authCookie(AccessTokenCookie, accessToken, "/", AccessTokenExpiry, true))
+	http.SetCookie(w, authCookie(RefreshTokenCookie, refreshToken, refreshCookiePath, RefreshTokenExpiry, true))
+}
+
+func ClearAuthCookies(w http.ResponseWriter) {
+	http.SetCookie(w, authCookie(AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, authCookie(RefreshTokenCookie, "", refreshCookiePath, -1, true))
+}
+
+// IssueCsrfToken sets the double submit cookie. Unlike the auth cookies it
+// is readable from script, which has to echo it in the X-CSRF-Token header.
+func IssueCsrfToken(w http.ResponseWriter) (string, error) {
+	token, err := generateAlphaNumericToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, authCookie(CsrfCookie, token, "/", RefreshTokenExpiry, false))
+
+	return token, nil
+}
+
+// ValidCsrf reports whether a request authenticated by cookie echoed the
+// csrf cookie in its header. Safe methods never need it.
+func ValidCsrf(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := r.Cookie(CsrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(CsrfHeader))) == 1
+}
+
+func authCookie(name, value, path string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   config.CookieConfig.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   true,
+		SameSite: config.CookieConfig.SameSite,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
@@ -0,0 +1,82 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+)
+
+const EmailChangeExpiry = time.Hour * 1
+
+type EmailChange struct {
+	UserId string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// GenerateEmailChange mails a confirmation link to the new address and a
+// heads-up to the current one. Nothing changes on the user until the link
+// is followed.
+func GenerateEmailChange(ctx context.Context, user *models.User, newEmail string) error {
+	token, err := generateAlphaNumericToken(32)
+	if err != nil {
+		return err
+	}
+
+	change, err := json.Marshal(EmailChange{UserId: user.Id, Email: newEmail})
+	if err != nil {
+		return err
+	}
+
+	err = config.Redis.Set(ctx, "change_email_"+token, change, EmailChangeExpiry).Err()
+	if err != nil {
+		return err
+	}
+
+	apiHost := config.GetApiHost()
+
+	err = mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "change_email",
+		To:           newEmail,
+		Subject:      "Confirm Your New Email",
+		Data: map[string]interface{}{
+			"confirm_link": fmt.Sprintf("%s/auth/confirm-email-change?token=%s", apiHost, token),
+			"Name":         user.Name,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "email_change_notice",
+		To:           user.Email,
+		Subject:      "Your Email Is Being Changed",
+		Data: map[string]interface{}{
+			"new_email": newEmail,
+			"Name":      user.Name,
+		},
+	})
+}
+
+func ConsumeEmailChange(ctx context.Context, token string) (EmailChange, error) {
+	var change EmailChange
+
+	data, err := config.Redis.GetDel(ctx, "change_email_"+token).Result()
+	if err == redis.Nil {
+		return change, errors.ErrInvalidEmailChange
+	} else if err != nil {
+		return change, err
+	}
+
+	err = json.Unmarshal([]byte(data), &change)
+	return change, err
+}
@@ -0,0 +1,30 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type Device struct {
+	UserAgent string
+	IpAddress string
+	RequestId string
+}
+
+// DeviceFromRequest reads the client details recorded against a session
+// and in the audit trail. RemoteAddr has already been rewritten by chi's
+// middleware.RealIP, the request id comes from middleware.RequestID.
+func DeviceFromRequest(r *http.Request) Device {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	return Device{
+		UserAgent: r.UserAgent(),
+		IpAddress: ip,
+		RequestId: middleware.GetReqID(r.Context()),
+	}
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"fmt"
 	"math/big"
 	"time"
@@ -16,6 +17,15 @@ import (
 	"github.com/dudeiebot/ad-ly/queue"
 )
 
+const (
+	verificationCodeLength      = 6
+	verificationCodeMaxAttempts = 5
+	// wrong codes a user gets across resends before verifying by code is
+	// refused for the rest of the window; the link keeps working
+	verificationCodeMaxGuesses  = 15
+	verificationCodeGuessWindow = time.Hour * 24
+)
+
 func generateAlphaNumericToken(length int) (string, error) {
 	const charset = "0123456789abcdefghijklmnopqrstuvwxyz"
 	token := make([]byte, length)
@@ -31,15 +41,44 @@ func generateAlphaNumericToken(length int) (string, error) {
 	return string(token), nil
 }
 
+func generateNumericCode(length int) (string, error) {
+	code := make([]byte, length)
+
+	for i := range code {
+		num, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + num.Int64())
+	}
+
+	return string(code), nil
+}
+
+// GenerateOtpToken emails both a verification link and a short numeric code
+// so mobile clients can verify in-app without opening a browser.
 func GenerateOtpToken(ctx context.Context, user *models.User) error {
 	otpToken, err := generateAlphaNumericToken(10)
 	if err != nil {
 		return err
 	}
 
+	otpCode, err := generateNumericCode(verificationCodeLength)
+	if err != nil {
+		return err
+	}
+
 	redisKey := "signup_otp_" + otpToken
+	codeKey := "signup_code_" + user.Id
 
-	err = config.Redis.Set(ctx, redisKey, user.Id, time.Minute*10).Err()
+	_, err = config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, redisKey, user.Id, time.Minute*10)
+		// a resend replaces the previous code and its attempt count
+		pipe.Del(ctx, codeKey)
+		pipe.HSet(ctx, codeKey, "code", otpCode, "attempts", 0)
+		pipe.Expire(ctx, codeKey, time.Minute*10)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
@@ -52,6 +91,7 @@ func GenerateOtpToken(ctx context.Context, user *models.User) error {
 		Subject:      "Verify Your Email",
 		Data: map[string]interface{}{
 			"verification_link": fmt.Sprintf("%s/auth/verify-email?token=%s", apiHost, otpToken),
+			"verification_code": otpCode,
 			"Name":              user.Name,
 		},
 	})
@@ -61,12 +101,80 @@ func GenerateOtpToken(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+// VerifyOtpCode checks the numeric code sent alongside the verification
+// link. The code is burnt after too many wrong guesses, and a resend does
+// not reset the guesses counted against the user.
+func VerifyOtpCode(ctx context.Context, userId, code string) error {
+	codeKey := "signup_code_" + userId
+	guessesKey := "signup_code_guesses_" + userId
+
+	guesses, err := config.Redis.Get(ctx, guessesKey).Int64()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if guesses >= verificationCodeMaxGuesses {
+		return errors.ErrTooManyCodeGuesses
+	}
+
+	stored, err := config.Redis.HGet(ctx, codeKey, "code").Result()
+	if err == redis.Nil {
+		return errors.ErrInvalidVerificationCode
+	} else if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(code)) == 1 {
+		return config.Redis.Del(ctx, codeKey, guessesKey).Err()
+	}
+
+	if _, err = countFailure(ctx, guessesKey, verificationCodeGuessWindow); err != nil {
+		return err
+	}
+
+	attempts, err := config.Redis.HIncrBy(ctx, codeKey, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+	if attempts >= verificationCodeMaxAttempts {
+		if err = config.Redis.Del(ctx, codeKey).Err(); err != nil {
+			return err
+		}
+	}
+
+	return errors.ErrInvalidVerificationCode
+}
+
+// VerificationCooldown reports how long until another verification email
+// can be sent, without starting a new cooldown.
+func VerificationCooldown(ctx context.Context, userId string) (time.Duration, error) {
+	ttl, err := config.Redis.TTL(ctx, "verify_cooldown_"+userId).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
 func CanSendVerification(ctx context.Context, userId string) error {
-	cooldownKey := "verify_cooldown_" + userId
+	return checkCooldown(ctx, "verify_cooldown_"+userId, errors.ErrCantSendVerificationMail)
+}
+
+func CanSendMagicLink(ctx context.Context, userId string) error {
+	return checkCooldown(ctx, "magic_link_cooldown_"+userId, errors.ErrCantSendMagicLink)
+}
+
+func CanRequestDataExport(ctx context.Context, userId string) error {
+	return checkCooldown(ctx, "export_cooldown_"+userId, errors.ErrCantRequestDataExport)
+}
 
+// checkCooldown lets one mail through per window for the given key and
+// answers cooldownErr for the rest.
+func checkCooldown(ctx context.Context, cooldownKey string, cooldownErr error) error {
 	_, err := config.Redis.Get(ctx, cooldownKey).Result()
 	if err == nil {
-		return errors.ErrCantSendVerificationMail
+		return cooldownErr
 	} else if err != redis.Nil {
 		return err
 	}
@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+)
+
+const InvitationExpiry = time.Hour * 24 * 7
+
+// GenerateInvitationToken returns the token to email and the hash to
+// store in its place.
+func GenerateInvitationToken() (token, tokenHash string, err error) {
+	token, err = generateAlphaNumericToken(40)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashInvitationToken(token), nil
+}
+
+func HashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func SendInvitation(
+	invitation models.Invitation,
+	organization models.Organization,
+	inviter models.User,
+	token string,
+) error {
+	apiHost := config.GetApiHost()
+
+	return mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "organization_invitation",
+		To:           invitation.Email,
+		Subject:      fmt.Sprintf("You Have Been Invited To %s", organization.Name),
+		Data: map[string]interface{}{
+			"invitation_link": fmt.Sprintf("%s/invitations?token=%s", apiHost, token),
+			"organization":    organization.Name,
+			"inviter":         inviter.Name,
+			"role":            invitation.Role,
+		},
+	})
+}
@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/dudeiebot/ad-ly/config"
+)
+
+// SignClaims signs any token we hand out, access and refresh tokens as
+// well as the tokens issued to oauth clients. With an asymmetric
+// JWT_ALGORITHM the current signing key is used and named in the kid
+// header, otherwise the app key is.
+func SignClaims(claims jwt.MapClaims) (string, error) {
+	if config.AuthConfig.JwtAlgorithm == jwt.SigningMethodHS256.Alg() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).
+			SignedString([]byte(config.AppConfig.AppKey))
+	}
+
+	key := currentSigningKey()
+	if key == nil {
+		return "", fmt.Errorf("no signing key loaded")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	return token.SignedString(key.privateKey)
+}
+
+// ParseClaims verifies a token signed by SignClaims and returns its claims.
+// Tokens without a kid are signed with the app key. After switching to an
+// asymmetric algorithm they are only accepted until the last one signed
+// before the switch has expired, see appKeyTokensAccepted.
+func ParseClaims(token string) (jwt.MapClaims, error) {
+	validation, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if token.Method != jwt.SigningMethodHS256 || !appKeyTokensAccepted() {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(config.AppConfig.AppKey), nil
+		}
+
+		key := verificationKey(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return key.publicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := validation.Claims.(jwt.MapClaims)
+	if !ok || !validation.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
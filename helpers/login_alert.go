@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+)
+
+const (
+	// a device not signed in from for this long is treated as new again
+	KnownDeviceExpiry = time.Hour * 24 * 180
+	LoginAlertExpiry  = time.Hour * 24 * 7
+)
+
+// RememberDevice marks the device and ip as known for the user and reports
+// whether they were new. Only creating the account adds the first device
+// without an alert; a user with no known devices, after ForgetDevices, after
+// KnownDeviceExpiry or from before alerts, is alerted on their next sign in.
+func RememberDevice(ctx context.Context, userId string, device Device) (bool, error) {
+	key := "known_devices_" + userId
+
+	added, err := config.Redis.SAdd(ctx, key, deviceFingerprint(device)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if err = config.Redis.Expire(ctx, key, KnownDeviceExpiry).Err(); err != nil {
+		return false, err
+	}
+
+	return added == 1, nil
+}
+
+// ForgetDevices makes every device new again, so the next sign in from
+// any of them sends an alert.
+func ForgetDevices(ctx context.Context, userId string) error {
+	return config.Redis.Del(ctx, "known_devices_"+userId).Err()
+}
+
+// SendLoginAlert mails the user about a sign in from a new device. The
+// link in it lets them disown the sign in, see ConsumeLoginAlert.
+func SendLoginAlert(ctx context.Context, user models.User, device Device) error {
+	token, err := generateAlphaNumericToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = config.Redis.Set(ctx, "login_alert_"+token, user.Id, LoginAlertExpiry).Err()
+	if err != nil {
+		return err
+	}
+
+	apiHost := config.GetApiHost()
+
+	return mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "new_sign_in",
+		To:           user.Email,
+		Subject:      "New Sign In To Your Account",
+		Data: map[string]interface{}{
+			"not_me_link": fmt.Sprintf("%s/auth/not-me?token=%s", apiHost, token),
+			"Name":        user.Name,
+			"user_agent":  device.UserAgent,
+			"ip_address":  device.IpAddress,
+			"signed_in":   time.Now().UTC().Format(time.RFC1123),
+		},
+	})
+}
+
+// ConsumeLoginAlert returns the user a sign in alert was sent to. Each
+// link works once.
+func ConsumeLoginAlert(ctx context.Context, token string) (string, error) {
+	userId, err := config.Redis.GetDel(ctx, "login_alert_"+token).Result()
+	if err == redis.Nil {
+		return "", errors.ErrInvalidLoginAlert
+	}
+	return userId, err
+}
+
+func deviceFingerprint(device Device) string {
+	sum := sha256.Sum256([]byte(device.UserAgent + "\n" + device.IpAddress))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,171 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+)
+
+const (
+	loginBackoffBase = time.Second
+	loginBackoffMax  = time.Minute * 5
+	// failures per ip are counted across accounts, so the window is
+	// kept fixed rather than tied to the account lockout
+	loginIpFailureWindow = time.Minute * 15
+)
+
+// CheckLoginThrottle refuses the attempt while the account is locked or
+// while the account or ip is still serving an earlier back-off.
+func CheckLoginThrottle(ctx context.Context, userId, ip string) error {
+	if userId != "" {
+		locked, err := LoginLocked(ctx, userId)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return errors.ErrAccountLocked
+		}
+	}
+
+	backoff, err := config.Redis.Exists(ctx,
+		"login_backoff_user_"+userId,
+		"login_backoff_ip_"+ip,
+	).Result()
+	if err != nil {
+		return err
+	}
+	if backoff != 0 {
+		return errors.ErrTooManyLoginAttempts
+	}
+
+	return nil
+}
+
+// LoginLocked reports whether too many failed attempts locked the account.
+func LoginLocked(ctx context.Context, userId string) (bool, error) {
+	locked, err := config.Redis.Exists(ctx, "login_locked_"+userId).Result()
+	return locked != 0, err
+}
+
+// RecordLoginFailure counts a failed attempt against the ip and, when the
+// email matched, the account. Each failure doubles the back-off, and the
+// account is locked once it reaches config.AuthConfig.LoginMaxAttempts.
+func RecordLoginFailure(ctx context.Context, user *models.User, ip string) error {
+	ipFailures, err := countFailure(ctx, "login_failures_ip_"+ip, loginIpFailureWindow)
+	if err != nil {
+		return err
+	}
+
+	err = config.Redis.Set(ctx, "login_backoff_ip_"+ip, true, loginBackoff(ipFailures)).Err()
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	lockout := config.AuthConfig.LoginLockoutDuration
+
+	userFailures, err := countFailure(ctx, "login_failures_user_"+user.Id, lockout)
+	if err != nil {
+		return err
+	}
+
+	if userFailures < int64(config.AuthConfig.LoginMaxAttempts) {
+		return config.Redis.Set(ctx, "login_backoff_user_"+user.Id, true, loginBackoff(userFailures)).Err()
+	}
+
+	locked, err := config.Redis.SetNX(ctx, "login_locked_"+user.Id, true, lockout).Result()
+	if err != nil {
+		return err
+	}
+
+	// only the attempt that tripped the lock sends the unlock email
+	if locked {
+		if err = sendUnlockEmail(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	return errors.ErrAccountLocked
+}
+
+func ClearLoginFailures(ctx context.Context, userId string) error {
+	return config.Redis.Del(ctx,
+		"login_failures_user_"+userId,
+		"login_backoff_user_"+userId,
+		"login_locked_"+userId,
+	).Err()
+}
+
+func UnlockAccount(ctx context.Context, token string) error {
+	userId, err := config.Redis.GetDel(ctx, "login_unlock_"+token).Result()
+	if err == redis.Nil {
+		return errors.ErrInvalidUnlockToken
+	} else if err != nil {
+		return err
+	}
+
+	return ClearLoginFailures(ctx, userId)
+}
+
+func countFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := config.Redis.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// the window starts with the first failure and is not extended by later ones
+	if count == 1 {
+		if err = config.Redis.Expire(ctx, key, window).Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+func loginBackoff(failures int64) time.Duration {
+	if failures > 16 {
+		return loginBackoffMax
+	}
+
+	backoff := loginBackoffBase << (failures - 1)
+	if backoff > loginBackoffMax {
+		return loginBackoffMax
+	}
+	return backoff
+}
+
+func sendUnlockEmail(ctx context.Context, user *models.User) error {
+	token, err := generateAlphaNumericToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = config.Redis.Set(ctx, "login_unlock_"+token, user.Id, config.AuthConfig.LoginLockoutDuration).Err()
+	if err != nil {
+		return err
+	}
+
+	apiHost := config.GetApiHost()
+
+	return mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "account_locked",
+		To:           user.Email,
+		Subject:      "Your Account Has Been Locked",
+		Data: map[string]interface{}{
+			"unlock_link": fmt.Sprintf("%s/auth/unlock?token=%s", apiHost, token),
+			"Name":        user.Name,
+		},
+	})
+}
@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+)
+
+const MagicLinkExpiry = time.Minute * 15
+
+func GenerateMagicLink(ctx context.Context, user *models.User) error {
+	token, err := generateAlphaNumericToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = config.Redis.Set(ctx, "magic_link_"+token, user.Id, MagicLinkExpiry).Err()
+	if err != nil {
+		return err
+	}
+
+	apiHost := config.GetApiHost()
+
+	return mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "magic_link",
+		To:           user.Email,
+		Subject:      "Your Sign In Link",
+		Data: map[string]interface{}{
+			"magic_link": fmt.Sprintf("%s/auth/magic-link/consume?token=%s", apiHost, token),
+			"Name":       user.Name,
+		},
+	})
+}
+
+// MagicLinkUser returns the user the link was issued to without using it up.
+func MagicLinkUser(ctx context.Context, token string) (string, error) {
+	userId, err := config.Redis.Get(ctx, "magic_link_"+token).Result()
+	if err == redis.Nil {
+		return "", errors.ErrInvalidMagicLink
+	}
+	return userId, err
+}
+
+// ConsumeMagicLink returns the user the link was issued to. The token is
+// removed in the same call so a link can only ever be used once.
+func ConsumeMagicLink(ctx context.Context, token string) (string, error) {
+	userId, err := config.Redis.GetDel(ctx, "magic_link_"+token).Result()
+	if err == redis.Nil {
+		return "", errors.ErrInvalidMagicLink
+	} else if err != nil {
+		return "", err
+	}
+	return userId, nil
+}
@@ -0,0 +1,115 @@
+package helpers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+)
+
+const (
+	OAuthStateExpiry = time.Minute * 10
+	OAuthStateCookie = "oauth_state"
+
+	oauthCookiePath = "/auth/oauth"
+)
+
+type OAuthState struct {
+	State    string
+	Provider string
+	Nonce    string
+	Verifier string
+	// set when an authenticated user is linking a provider rather than
+	// signing in with it
+	UserId string
+}
+
+func CreateOAuthState(ctx context.Context, provider, userId string) (OAuthState, error) {
+	state := OAuthState{
+		State:    uuid.New().String(),
+		Provider: provider,
+		Nonce:    uuid.New().String(),
+		Verifier: oauth2.GenerateVerifier(),
+		UserId:   userId,
+	}
+	stateKey := "oauth_state_" + state.State
+
+	_, err := config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, stateKey,
+			"provider", state.Provider,
+			"nonce", state.Nonce,
+			"verifier", state.Verifier,
+			"user_id", state.UserId,
+		)
+		pipe.Expire(ctx, stateKey, OAuthStateExpiry)
+		return nil
+	})
+	if err != nil {
+		return OAuthState{}, err
+	}
+
+	return state, nil
+}
+
+// SetOAuthStateCookie ties the flow to the browser that started it; the
+// callback is only accepted alongside the same state in this cookie. It is
+// always Lax, a Strict cookie would not come back on the provider's
+// redirect.
+func SetOAuthStateCookie(w http.ResponseWriter, state string) {
+	cookie := authCookie(OAuthStateCookie, state, oauthCookiePath, OAuthStateExpiry, true)
+	cookie.SameSite = http.SameSiteLaxMode
+	http.SetCookie(w, cookie)
+}
+
+func ClearOAuthStateCookie(w http.ResponseWriter) {
+	cookie := authCookie(OAuthStateCookie, "", oauthCookiePath, -1, true)
+	cookie.SameSite = http.SameSiteLaxMode
+	http.SetCookie(w, cookie)
+}
+
+// ValidOAuthStateCookie reports whether the request carries the state
+// cookie set when the flow was started.
+func ValidOAuthStateCookie(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(OAuthStateCookie)
+	if err != nil || cookie.Value == "" || state == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+// ConsumeOAuthState loads and removes the state so a callback can never be
+// replayed. The provider has to match the one the flow was started with.
+func ConsumeOAuthState(ctx context.Context, state, provider string) (OAuthState, error) {
+	stateKey := "oauth_state_" + state
+
+	var values *redis.MapStringStringCmd
+	_, err := config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.HGetAll(ctx, stateKey)
+		pipe.Del(ctx, stateKey)
+		return nil
+	})
+	if err != nil {
+		return OAuthState{}, err
+	}
+
+	stored := values.Val()
+	if len(stored) == 0 || stored["provider"] != provider {
+		return OAuthState{}, errors.ErrInvalidOAuthState
+	}
+
+	return OAuthState{
+		State:    state,
+		Provider: stored["provider"],
+		Nonce:    stored["nonce"],
+		Verifier: stored["verifier"],
+		UserId:   stored["user_id"],
+	}, nil
+}
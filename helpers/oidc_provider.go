@@ -0,0 +1,171 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+const (
+	AuthorizationCodeExpiry = time.Minute * 5
+	IdTokenExpiry           = time.Hour
+
+	oauthAccessTokenType = "oauth_access"
+)
+
+type AuthorizationCode struct {
+	ClientId      string
+	UserId        string
+	RedirectUri   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+}
+
+func CreateAuthorizationCode(ctx context.Context, grant AuthorizationCode) (string, error) {
+	code, err := generateAlphaNumericToken(32)
+	if err != nil {
+		return "", err
+	}
+	codeKey := "oauth_code_" + code
+
+	_, err = config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, codeKey,
+			"client_id", grant.ClientId,
+			"user_id", grant.UserId,
+			"redirect_uri", grant.RedirectUri,
+			"scope", grant.Scope,
+			"nonce", grant.Nonce,
+			"code_challenge", grant.CodeChallenge,
+		)
+		pipe.Expire(ctx, codeKey, AuthorizationCodeExpiry)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ConsumeAuthorizationCode loads and removes the code so it can only be
+// exchanged once, and only by the client it was issued to.
+func ConsumeAuthorizationCode(ctx context.Context, code, clientId string) (AuthorizationCode, error) {
+	codeKey := "oauth_code_" + code
+
+	var values *redis.MapStringStringCmd
+	_, err := config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.HGetAll(ctx, codeKey)
+		pipe.Del(ctx, codeKey)
+		return nil
+	})
+	if err != nil {
+		return AuthorizationCode{}, err
+	}
+
+	stored := values.Val()
+	if len(stored) == 0 || stored["client_id"] != clientId {
+		return AuthorizationCode{}, errors.ErrInvalidGrant
+	}
+
+	return AuthorizationCode{
+		ClientId:      stored["client_id"],
+		UserId:        stored["user_id"],
+		RedirectUri:   stored["redirect_uri"],
+		Scope:         stored["scope"],
+		Nonce:         stored["nonce"],
+		CodeChallenge: stored["code_challenge"],
+	}, nil
+}
+
+// VerifyCodeChallenge checks a PKCE verifier against the S256 challenge
+// sent to the authorize endpoint.
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// SignOAuthAccessToken issues the access token handed to an oauth client.
+// Unlike our own access tokens it is not backed by redis; subject is the
+// user for the authorization code grant and the client itself for client
+// credentials.
+func SignOAuthAccessToken(subject, clientId, scope string) (string, error) {
+	now := time.Now()
+
+	return SignClaims(jwt.MapClaims{
+		"iss":   config.GetApiHost(),
+		"sub":   subject,
+		"aud":   clientId,
+		"scope": scope,
+		"jti":   uuid.New().String(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(AccessTokenExpiry).Unix(),
+		"typ":   oauthAccessTokenType,
+	})
+}
+
+func ParseOAuthAccessToken(token string) (jwt.MapClaims, error) {
+	claims, err := ParseClaims(token)
+	if err != nil || claims["typ"] != oauthAccessTokenType {
+		return nil, errors.ErrInvalidAccessToken
+	}
+
+	return claims, nil
+}
+
+// SignIdToken refuses to sign with the app key, see
+// config.AuthEnv.OidcProviderEnabled.
+func SignIdToken(user models.User, clientId, scope, nonce string) (string, error) {
+	if !config.AuthConfig.OidcProviderEnabled() {
+		return "", errors.ErrOidcProviderDisabled
+	}
+
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss": config.GetApiHost(),
+		"sub": user.Id,
+		"aud": clientId,
+		"iat": now.Unix(),
+		"exp": now.Add(IdTokenExpiry).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	for key, value := range UserInfoClaims(user, scope) {
+		claims[key] = value
+	}
+
+	return SignClaims(claims)
+}
+
+// UserInfoClaims returns the standard claims the granted scope entitles a
+// client to see.
+func UserInfoClaims(user models.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.Id}
+
+	for _, granted := range strings.Fields(scope) {
+		switch granted {
+		case "profile":
+			claims["name"] = user.Name
+		case "email":
+			claims["email"] = user.Email
+			claims["email_verified"] = user.EmailVerified()
+		}
+	}
+
+	return claims
+}
@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+const PasskeyChallengeExpiry = time.Minute * 5
+
+var relyingParty struct {
+	once     sync.Once
+	webAuthn *webauthn.WebAuthn
+	err      error
+}
+
+// RelyingParty returns the WebAuthn relying party built from the
+// WEBAUTHN_* settings.
+func RelyingParty() (*webauthn.WebAuthn, error) {
+	relyingParty.once.Do(func() {
+		relyingParty.webAuthn, relyingParty.err = webauthn.New(&webauthn.Config{
+			RPID:          config.WebAuthnConfig.RPID,
+			RPDisplayName: config.AppConfig.AppName,
+			RPOrigins:     config.WebAuthnConfig.RPOrigins,
+			Timeouts: webauthn.TimeoutsConfig{
+				Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: PasskeyChallengeExpiry},
+				Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: PasskeyChallengeExpiry},
+			},
+		})
+	})
+	return relyingParty.webAuthn, relyingParty.err
+}
+
+// PasskeyUser adapts a user and their passkeys to webauthn.User. The user
+// handle is the user id, which lets a discoverable login find its owner.
+type PasskeyUser struct {
+	User     models.User
+	Passkeys []models.Passkey
+}
+
+func (u PasskeyUser) WebAuthnID() []byte {
+	return []byte(u.User.Id)
+}
+
+func (u PasskeyUser) WebAuthnName() string {
+	return u.User.Email
+}
+
+func (u PasskeyUser) WebAuthnDisplayName() string {
+	return u.User.Name
+}
+
+func (u PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Passkeys))
+	for _, passkey := range u.Passkeys {
+		credentials = append(credentials, PasskeyCredential(passkey))
+	}
+	return credentials
+}
+
+func PasskeyCredential(passkey models.Passkey) webauthn.Credential {
+	credentialId, _ := base64.RawURLEncoding.DecodeString(passkey.CredentialId)
+
+	var transports []protocol.AuthenticatorTransport
+	for _, transport := range strings.Fields(passkey.Transports) {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+
+	return webauthn.Credential{
+		ID:              credentialId,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    true,
+			UserVerified:   true,
+			BackupEligible: passkey.BackupEligible,
+			BackupState:    passkey.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    passkey.Aaguid,
+			SignCount: passkey.SignCount,
+		},
+	}
+}
+
+// NewPasskey turns a freshly registered credential into the row stored
+// for the user.
+func NewPasskey(userId, name string, credential *webauthn.Credential) models.Passkey {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return models.Passkey{
+		Id:              uuid.New().String(),
+		UserId:          userId,
+		Name:            name,
+		CredentialId:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, " "),
+		Aaguid:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+}
+
+// SavePasskeyChallenge keeps the ceremony state between its begin and
+// finish requests. ceremony is "register" or "login", so a challenge can
+// not be finished as the other kind.
+func SavePasskeyChallenge(ctx context.Context, ceremony string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	challengeId := uuid.New().String()
+
+	err = config.Redis.Set(ctx, "passkey_"+ceremony+"_"+challengeId, data, PasskeyChallengeExpiry).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return challengeId, nil
+}
+
+// ConsumePasskeyChallenge loads and removes the ceremony state, so every
+// challenge can only be answered once.
+func ConsumePasskeyChallenge(ctx context.Context, ceremony, challengeId string) (webauthn.SessionData, error) {
+	var session webauthn.SessionData
+
+	data, err := config.Redis.GetDel(ctx, "passkey_"+ceremony+"_"+challengeId).Bytes()
+	if err == redis.Nil {
+		return session, errors.ErrInvalidPasskeyChallenge
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err = json.Unmarshal(data, &session); err != nil {
+		return session, err
+	}
+
+	return session, nil
+}
@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Dudeiebot/dlog"
+
+	"github.com/dudeiebot/ad-ly/config"
+)
+
+var logger = dlog.NewLog(dlog.LevelTrace)
+
+// bcrypt ignores everything past 72 bytes
+const passwordMaxBytes = 72
+
+// PasswordPolicyError lists every rule of the password policy a password
+// breaks.
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e PasswordPolicyError) Error() string {
+	return strings.Join(e.Problems, ", ")
+}
+
+// ValidationErrors reports the problems the way ReturnValidatorErrors
+// reports a failed request validation.
+func (e PasswordPolicyError) ValidationErrors() url.Values {
+	return url.Values{"password": e.Problems}
+}
+
+// CheckPassword applies the PASSWORD_* policy to a new password for the
+// user with the given name and email. It returns a PasswordPolicyError
+// when the password is refused. A breached list that can not be read is
+// logged and skipped, so a broken mount does not stop every password
+// change.
+func CheckPassword(password, name, email string) error {
+	var problems []string
+
+	if utf8.RuneCountInString(password) < config.PasswordConfig.MinLength {
+		problems = append(problems, fmt.Sprintf("Password Must Be At Least %d Characters", config.PasswordConfig.MinLength))
+	}
+
+	if len(password) > passwordMaxBytes {
+		problems = append(problems, fmt.Sprintf("Password Must Be At Most %d Bytes", passwordMaxBytes))
+	}
+
+	for _, class := range config.PasswordConfig.RequiredClasses {
+		if !strings.ContainsFunc(password, passwordClasses[class].matches) {
+			problems = append(problems, "Password Must Contain "+passwordClasses[class].description)
+		}
+	}
+
+	personal := personalWords(name, email)
+	lower := strings.ToLower(password)
+	for _, word := range personal {
+		if strings.Contains(lower, word) {
+			problems = append(problems, "Password Must Not Contain Your Name Or Email")
+			break
+		}
+	}
+
+	if PasswordStrength(password, personal...) < config.PasswordConfig.MinStrength {
+		problems = append(problems, "Password Is Too Easy To Guess, Use A Longer Or Less Common One")
+	}
+
+	breached, err := PasswordBreached(password)
+	if err != nil {
+		logger.Error("Skipping breached password check", err)
+	}
+	if breached {
+		problems = append(problems, "Password Has Appeared In A Data Breach, Choose Another")
+	}
+
+	if len(problems) != 0 {
+		return PasswordPolicyError{Problems: problems}
+	}
+
+	return nil
+}
+
+// PasswordBreached looks the password up in the local copy of a breached
+// password list. Only the first five hex characters of its sha1 pick the
+// file to read, the same k-anonymity split the Have I Been Pwned range
+// api uses, so its downloads can be used as they are.
+func PasswordBreached(password string) (bool, error) {
+	if config.PasswordConfig.BreachedDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	file, err := os.Open(filepath.Join(config.PasswordConfig.BreachedDir, hash[:5]+".txt"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(suffix), hash[5:]) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+var passwordClasses = map[string]struct {
+	description string
+	matches     func(rune) bool
+}{
+	"lower":  {"A Lowercase Letter", unicode.IsLower},
+	"upper":  {"An Uppercase Letter", unicode.IsUpper},
+	"digit":  {"A Digit", unicode.IsDigit},
+	"symbol": {"A Symbol", func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }},
+}
+
+// personalWords are the parts of a name and email long enough to matter,
+// lower cased.
+func personalWords(name, email string) []string {
+	localPart, _, _ := strings.Cut(email, "@")
+
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(name+" "+localPart), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if utf8.RuneCountInString(word) >= 3 {
+			words = append(words, word)
+		}
+	}
+
+	if localPart = strings.ToLower(localPart); utf8.RuneCountInString(localPart) >= 3 {
+		words = append(words, localPart)
+	}
+
+	return words
+}
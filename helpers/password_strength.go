@@ -0,0 +1,285 @@
+package helpers
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is ranked most common first; a password found here takes
+// as many guesses as its rank.
+var commonPasswords = strings.Fields(`
+	password 123456 123456789 12345678 12345 qwerty abc123 password1 111111
+	1234567 iloveyou 123123 admin welcome monkey login letmein dragon 1234567890
+	football baseball sunshine princess master qwerty123 shadow superman
+	trustno1 michael hello freedom whatever qazwsx starwars passw0rd hunter
+	soccer batman charlie thomas jordan jennifer secret summer winter spring
+	autumn love lovely flower computer internet cheese pepper orange banana
+	apple purple ginger killer pokemon naruto samsung google chocolate
+	changeme default guest root test user pass access mustang maggie ashley
+	bailey michelle daniel andrew joshua matthew robert william hockey ranger
+	buster tigger jessica zxcvbn asdfgh football1 loveme angel
+	anthony nicole liverpool chelsea arsenal yankees dallas austin summer1
+	blink182 myspace mypass money family friends jesus christ heaven
+	baby babygirl sweet cookie coffee diamond silver golden hello123
+	abcdef abcd1234 qwertyuiop 1q2w3e4r 1qaz2wsx zaq12wsx 666666 888888
+	000000 121212 654321 987654321 7777777 159753 112233 adminadmin
+	administrator letmein1 welcome1 password123 secret123 temp temporary
+`)
+
+var commonPasswordRanks = func() map[string]int {
+	ranks := make(map[string]int, len(commonPasswords))
+	for i, word := range commonPasswords {
+		if _, exists := ranks[word]; !exists {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i',
+	'!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+var keyboardRows = []string{
+	"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "!@#$%^&*()",
+	"1qaz2wsx3edc4rfv", "zaq1xsw2cde3",
+}
+
+// PasswordStrength scores how hard the password is to guess from 0, found
+// in a handful of tries, to 4, out of reach of an offline attack. Like
+// zxcvbn it splits the password into the cheapest mix of common passwords,
+// repeats, sequences, keyboard runs, years and random characters, and
+// counts the guesses that mix takes. userInputs are words an attacker
+// knows about the user, such as their name, and cost a single guess.
+func PasswordStrength(password string, userInputs ...string) int {
+	guesses := passwordGuesses(password, userInputs)
+
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// passwordGuesses returns log10 of the guesses needed for the cheapest
+// split of password.
+func passwordGuesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	// lowered rune by rune, strings.ToLower can change the length
+	lower, unleet := make([]rune, n), make([]rune, n)
+	for i, r := range runes {
+		lower[i], unleet[i] = unicode.ToLower(r), unicode.ToLower(r)
+		if substitute, ok := leetSubstitutions[lower[i]]; ok {
+			unleet[i] = substitute
+		}
+	}
+
+	inputs := make(map[string]bool, len(userInputs))
+	for _, input := range userInputs {
+		if input = strings.ToLower(input); len([]rune(input)) >= 3 {
+			inputs[input] = true
+		}
+	}
+
+	bruteforce := math.Log10(float64(passwordCardinality(runes)))
+
+	// best[k] is the cheapest split of the first k characters
+	best := make([]float64, n+1)
+	for k := 1; k <= n; k++ {
+		best[k] = best[k-1] + bruteforce
+
+		for i := 0; i <= k-3; i++ {
+			if guesses, ok := segmentGuesses(runes[i:k], lower[i:k], unleet[i:k], inputs); ok {
+				// every pattern costs at least ten guesses, so stringing
+				// common words together still adds up
+				best[k] = math.Min(best[k], best[i]+math.Max(guesses, 1))
+			}
+		}
+	}
+
+	return best[n]
+}
+
+// segmentGuesses returns log10 of the guesses for the cheapest pattern the
+// segment matches, if it matches any.
+func segmentGuesses(original, lower, unleet []rune, inputs map[string]bool) (float64, bool) {
+	guesses, matched := math.Inf(1), false
+	consider := func(g float64) {
+		guesses, matched = math.Min(guesses, g), true
+	}
+
+	word := string(unleet)
+	variations := math.Log10(caseVariations(original))
+	if string(lower) != word {
+		variations += math.Log10(2)
+	}
+	if inputs[word] || inputs[string(lower)] {
+		consider(variations)
+	}
+	if rank, ok := commonPasswordRanks[word]; ok {
+		consider(math.Log10(float64(rank)) + variations)
+	}
+	if rank, ok := commonPasswordRanks[string(lower)]; ok {
+		consider(math.Log10(float64(rank)) + math.Log10(caseVariations(original)))
+	}
+
+	length := float64(len(lower))
+
+	if isRepeat(lower) {
+		consider(math.Log10(float64(passwordCardinality(lower[:1])) * length))
+	}
+
+	if descending, ok := isSequence(lower); ok {
+		base := 26.0
+		switch {
+		case strings.ContainsRune("az019", lower[0]):
+			base = 4
+		case unicode.IsDigit(lower[0]):
+			base = 10
+		}
+		if descending {
+			base *= 2
+		}
+		consider(math.Log10(base * length))
+	}
+
+	if len(lower) >= 4 && isKeyboardRun(string(lower)) {
+		consider(math.Log10(40 * length))
+	}
+
+	if isYear(lower) {
+		consider(math.Log10(120))
+	}
+
+	return guesses, matched
+}
+
+func caseVariations(word []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	if upper == 0 || lower == 0 {
+		if upper == 0 {
+			return 1
+		}
+		return 2
+	}
+	// a capital first or last letter is the first thing tried
+	if upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1])) {
+		return 2
+	}
+
+	variations := 0.0
+	for i := 1; i <= min(upper, lower); i++ {
+		variations += binomial(upper+lower, i)
+	}
+	return variations
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func passwordCardinality(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	cardinality := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			cardinality += class.size
+		}
+	}
+	return max(cardinality, 10)
+}
+
+func isRepeat(word []rune) bool {
+	for _, r := range word[1:] {
+		if r != word[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func isSequence(word []rune) (descending bool, ok bool) {
+	step := word[1] - word[0]
+	if step != 1 && step != -1 {
+		return false, false
+	}
+	for i := 2; i < len(word); i++ {
+		if word[i]-word[i-1] != step {
+			return false, false
+		}
+	}
+	return step == -1, true
+}
+
+func isKeyboardRun(word string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, word) || strings.Contains(reverseString(row), word) {
+			return true
+		}
+	}
+	return false
+}
+
+func isYear(word []rune) bool {
+	if len(word) != 4 || (string(word[:2]) != "19" && string(word[:2]) != "20") {
+		return false
+	}
+	for _, r := range word[2:] {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
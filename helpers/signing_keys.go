@@ -0,0 +1,449 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+const (
+	// how long clients may cache the jwks
+	JwksMaxAge = time.Minute * 10
+
+	// other instances pick up a rotation within this window
+	signingKeysRefreshInterval = time.Minute * 5
+	// an unknown kid triggers a reload at most this often
+	signingKeysReloadCooldown = time.Second * 30
+	// a new key only signs once every instance publishes it and every
+	// cached copy of the old jwks has expired
+	signingKeyPublishDelay = signingKeysRefreshInterval + JwksMaxAge
+
+	// marks a private key sealed with the app key, older rows hold the pem
+	sealedKeyPrefix = "sealed:"
+)
+
+type signingKey struct {
+	id          string
+	method      jwt.SigningMethod
+	privateKey  crypto.PrivateKey
+	publicKey   crypto.PublicKey
+	activatesAt time.Time
+}
+
+type JsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+var keyring struct {
+	sync.RWMutex
+	current *signingKey
+	// published but not signing before its activatesAt
+	next     *signingKey
+	keys     map[string]*signingKey
+	loadedAt time.Time
+	// tokens signed with the app key before the first key pair was created
+	// have all expired by then
+	appKeyUntil time.Time
+}
+
+var keyringLoads singleflight.Group
+
+// LoadSigningKeys caches every key that can still verify a token, picks
+// the newest active one for signing and the one about to take over from
+// it. When an asymmetric algorithm is configured and no key exists yet,
+// the first one is created. Private keys still stored as plain pem are
+// sealed on the way.
+func LoadSigningKeys() error {
+	if config.AuthConfig.JwtAlgorithm == jwt.SigningMethodHS256.Alg() {
+		return nil
+	}
+
+	var stored []models.SigningKey
+
+	err := config.PostDb.
+		Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-RefreshTokenExpiry)).
+		Order("created_at DESC").
+		Find(&stored).Error
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	keys := make(map[string]*signingKey, len(stored))
+	var current, next *signingKey
+
+	for _, key := range stored {
+		parsed, err := parseSigningKey(key)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", key.Id, err)
+		}
+		keys[key.Id] = parsed
+
+		if !strings.HasPrefix(key.PrivateKey, sealedKeyPrefix) {
+			if err = sealStoredSigningKey(key); err != nil {
+				return fmt.Errorf("signing key %s: %w", key.Id, err)
+			}
+		}
+
+		if key.Algorithm != config.AuthConfig.JwtAlgorithm || (key.RetiredAt != nil && !key.RetiredAt.After(now)) {
+			continue
+		}
+
+		if key.ActivatesAt.After(now) {
+			if next == nil {
+				next = parsed
+			}
+		} else if current == nil {
+			current = parsed
+		}
+	}
+
+	if current == nil {
+		_, err = RotateSigningKey()
+		return err
+	}
+
+	keyring.Lock()
+	keyring.current = current
+	keyring.next = next
+	keyring.keys = keys
+	keyring.loadedAt = time.Now()
+	keyring.appKeyUntil = stored[len(stored)-1].CreatedAt.Add(RefreshTokenExpiry)
+	keyring.Unlock()
+
+	return nil
+}
+
+// RotateSigningKey creates a new key pair for the configured algorithm,
+// retires the keys signing until it takes over and forgets the ones no
+// live token can have been signed with anymore. The new key is published
+// right away but only signs after signingKeyPublishDelay, so clients
+// holding a cached jwks can verify its tokens; when no key of the
+// algorithm is signing yet there is nobody to wait for.
+func RotateSigningKey() (models.SigningKey, error) {
+	key, err := generateSigningKey(config.AuthConfig.JwtAlgorithm)
+	if err != nil {
+		return key, err
+	}
+
+	now := time.Now()
+
+	var signing int64
+	err = config.PostDb.Model(&models.SigningKey{}).
+		Where("algorithm = ? AND activates_at <= ? AND (retired_at IS NULL OR retired_at > ?)", key.Algorithm, now, now).
+		Count(&signing).Error
+	if err != nil {
+		return key, err
+	}
+
+	key.ActivatesAt = now
+	if signing > 0 {
+		key.ActivatesAt = now.Add(signingKeyPublishDelay)
+	}
+
+	err = config.PostDb.
+		Where("retired_at IS NULL OR retired_at > ?", key.ActivatesAt).
+		Model(&models.SigningKey{}).
+		Update("retired_at", key.ActivatesAt).Error
+	if err != nil {
+		return key, err
+	}
+
+	if err = config.PostDb.Create(&key).Error; err != nil {
+		return key, err
+	}
+
+	err = config.PostDb.
+		Where("retired_at < ?", now.Add(-RefreshTokenExpiry)).
+		Delete(&models.SigningKey{}).Error
+	if err != nil {
+		return key, err
+	}
+
+	return key, LoadSigningKeys()
+}
+
+// JsonWebKeys returns the public half of every key that still verifies
+// tokens, for the jwks endpoint.
+func JsonWebKeys() []JsonWebKey {
+	refreshSigningKeys()
+
+	keyring.RLock()
+	defer keyring.RUnlock()
+
+	jwks := make([]JsonWebKey, 0, len(keyring.keys))
+	for _, key := range keyring.keys {
+		jwk := JsonWebKey{Use: "sig", Alg: key.method.Alg(), Kid: key.id}
+
+		switch publicKey := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+
+		jwks = append(jwks, jwk)
+	}
+
+	return jwks
+}
+
+// appKeyTokensAccepted reports whether a token without a kid, signed with
+// the app key, may still be verified.
+func appKeyTokensAccepted() bool {
+	if config.AuthConfig.JwtAlgorithm == jwt.SigningMethodHS256.Alg() {
+		return true
+	}
+
+	refreshSigningKeys()
+
+	keyring.RLock()
+	defer keyring.RUnlock()
+
+	return time.Now().Before(keyring.appKeyUntil)
+}
+
+func currentSigningKey() *signingKey {
+	refreshSigningKeys()
+
+	keyring.RLock()
+	defer keyring.RUnlock()
+
+	// instances switch at the same moment, whenever they last reloaded
+	if keyring.next != nil && !time.Now().Before(keyring.next.activatesAt) {
+		return keyring.next
+	}
+	return keyring.current
+}
+
+func verificationKey(kid string) *signingKey {
+	refreshSigningKeys()
+
+	keyring.RLock()
+	key, loadedAt := keyring.keys[kid], keyring.loadedAt
+	keyring.RUnlock()
+
+	// another instance may have rotated since we last loaded
+	if key == nil && time.Since(loadedAt) > signingKeysReloadCooldown {
+		reloadSigningKeys(signingKeysReloadCooldown)
+
+		keyring.RLock()
+		key = keyring.keys[kid]
+		keyring.RUnlock()
+	}
+
+	return key
+}
+
+func refreshSigningKeys() {
+	keyring.RLock()
+	stale := time.Since(keyring.loadedAt) > signingKeysRefreshInterval
+	keyring.RUnlock()
+
+	if stale {
+		reloadSigningKeys(signingKeysRefreshInterval)
+	}
+}
+
+// reloadSigningKeys runs LoadSigningKeys once for every caller that finds
+// the keyring older than maxAge at the same time, and not at all for those
+// arriving after one of them reloaded it.
+func reloadSigningKeys(maxAge time.Duration) {
+	_, _, _ = keyringLoads.Do("signing_keys", func() (interface{}, error) {
+		keyring.RLock()
+		stale := time.Since(keyring.loadedAt) > maxAge
+		keyring.RUnlock()
+
+		if !stale {
+			return nil, nil
+		}
+		return nil, LoadSigningKeys()
+	})
+}
+
+func generateSigningKey(algorithm string) (models.SigningKey, error) {
+	var privateKey crypto.PrivateKey
+	var publicKey crypto.PublicKey
+
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return models.SigningKey{}, err
+		}
+		privateKey, publicKey = rsaKey, &rsaKey.PublicKey
+	case jwt.SigningMethodEdDSA.Alg():
+		edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return models.SigningKey{}, err
+		}
+		privateKey, publicKey = edPrivate, edPublic
+	default:
+		return models.SigningKey{}, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	privateDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	publicDer, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	id := uuid.New().String()
+
+	sealed, err := sealPrivateKey(id, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer}))
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		Id:         id,
+		Algorithm:  algorithm,
+		PrivateKey: sealed,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})),
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+func parseSigningKey(key models.SigningKey) (*signingKey, error) {
+	method := jwt.GetSigningMethod(key.Algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", key.Algorithm)
+	}
+
+	privatePem, err := openPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	privateBlock, _ := pem.Decode(privatePem)
+	publicBlock, _ := pem.Decode([]byte(key.PublicKey))
+	if privateBlock == nil || publicBlock == nil {
+		return nil, fmt.Errorf("invalid pem")
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(publicBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey{
+		id:          key.Id,
+		method:      method,
+		privateKey:  privateKey,
+		publicKey:   publicKey,
+		activatesAt: key.ActivatesAt,
+	}, nil
+}
+
+// signingKeyCipher encrypts private keys at rest with a key derived from
+// the app key, so a copy of the database alone can not sign tokens.
+func signingKeyCipher() (cipher.AEAD, error) {
+	secret := make([]byte, 32)
+	derived := hkdf.New(sha256.New, []byte(config.AppConfig.AppKey), nil, []byte("signing keys"))
+	if _, err := io.ReadFull(derived, secret); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealPrivateKey encrypts the pem, bound to the key's id so a sealed key
+// can not be moved to another row.
+func sealPrivateKey(id string, privatePem []byte) (string, error) {
+	aead, err := signingKeyCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, privatePem, []byte(id))
+	return sealedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openPrivateKey(key models.SigningKey) ([]byte, error) {
+	if !strings.HasPrefix(key.PrivateKey, sealedKeyPrefix) {
+		return []byte(key.PrivateKey), nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(key.PrivateKey, sealedKeyPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := signingKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed private key too short")
+	}
+
+	privatePem, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(key.Id))
+	if err != nil {
+		return nil, fmt.Errorf("can not open private key, was APP_KEY changed: %w", err)
+	}
+	return privatePem, nil
+}
+
+// sealStoredSigningKey encrypts a key stored before keys were sealed.
+func sealStoredSigningKey(key models.SigningKey) error {
+	sealed, err := sealPrivateKey(key.Id, []byte(key.PrivateKey))
+	if err != nil {
+		return err
+	}
+
+	return config.PostDb.Model(&models.SigningKey{}).
+		Where("id = ? AND private_key = ?", key.Id, key.PrivateKey).
+		Update("private_key", sealed).Error
+}
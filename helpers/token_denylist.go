@@ -0,0 +1,140 @@
+package helpers
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+)
+
+const (
+	tokenDenylistKey = "token_denylist"
+	// revocations made on another instance are seen within this window
+	tokenDenylistRefreshInterval = time.Second * 5
+
+	denylistFilterBits   = 1 << 16
+	denylistFilterHashes = 4
+)
+
+// bloomFilter answers "definitely not denied" without leaving the process;
+// a hit still has to be confirmed against redis.
+type bloomFilter struct {
+	bits [denylistFilterBits / 64]uint64
+}
+
+func (f *bloomFilter) add(tokenId string) {
+	for _, bit := range bloomBits(tokenId) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) mayContain(tokenId string) bool {
+	for _, bit := range bloomBits(tokenId) {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomBits(tokenId string) [denylistFilterHashes]uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(tokenId))
+	sum := hash.Sum64()
+
+	var bits [denylistFilterHashes]uint64
+	for i := range bits {
+		bits[i] = (sum>>32 + uint64(i)*(sum&0xffffffff)) % denylistFilterBits
+	}
+	return bits
+}
+
+var denylist struct {
+	sync.Mutex
+	filter   *bloomFilter
+	loadedAt time.Time
+}
+
+// DenyTokens revokes access tokens by id until they would have expired
+// anyway. Only stateless verification consults the denylist.
+func DenyTokens(ctx context.Context, tokenIds ...string) error {
+	if len(tokenIds) == 0 {
+		return nil
+	}
+
+	expiresAt := float64(time.Now().Add(AccessTokenExpiry).Unix())
+	members := make([]redis.Z, 0, len(tokenIds))
+	for _, tokenId := range tokenIds {
+		members = append(members, redis.Z{Score: expiresAt, Member: tokenId})
+	}
+
+	if err := config.Redis.ZAdd(ctx, tokenDenylistKey, members...).Err(); err != nil {
+		return err
+	}
+
+	denylist.Lock()
+	if denylist.filter != nil {
+		for _, tokenId := range tokenIds {
+			denylist.filter.add(tokenId)
+		}
+	}
+	denylist.Unlock()
+
+	return nil
+}
+
+func IsTokenDenied(ctx context.Context, tokenId string) (bool, error) {
+	denylist.Lock()
+	if denylist.filter == nil || time.Since(denylist.loadedAt) > tokenDenylistRefreshInterval {
+		if err := reloadTokenDenylist(ctx); err != nil {
+			denylist.Unlock()
+			return false, err
+		}
+	}
+	maybeDenied := denylist.filter.mayContain(tokenId)
+	denylist.Unlock()
+
+	if !maybeDenied {
+		return false, nil
+	}
+
+	score, err := config.Redis.ZScore(ctx, tokenDenylistKey, tokenId).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return int64(score) > time.Now().Unix(), nil
+}
+
+// reloadTokenDenylist drops expired entries and rebuilds the filter from
+// what is left. The caller holds the denylist lock.
+func reloadTokenDenylist(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if err := config.Redis.ZRemRangeByScore(ctx, tokenDenylistKey, "-inf", now).Err(); err != nil {
+		return err
+	}
+
+	tokenIds, err := config.Redis.ZRange(ctx, tokenDenylistKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	filter := &bloomFilter{}
+	for _, tokenId := range tokenIds {
+		filter.add(tokenId)
+	}
+
+	denylist.filter = filter
+	denylist.loadedAt = time.Now()
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package helpers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// accept the previous and next step to allow for clock drift
+	totpSkew = 1
+
+	MfaChallengeExpiry      = time.Minute * 5
+	mfaChallengeMaxAttempts = 5
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTotpSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TotpUri builds the otpauth:// uri authenticator apps read from a QR code.
+func TotpUri(secret, accountName string) string {
+	issuer := config.AppConfig.AppName
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + accountName)
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+// ValidateTotpCode checks a code against the RFC 6238 value for the current
+// time step and its neighbours.
+func ValidateTotpCode(secret, code string) bool {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return false
+	}
+
+	counter := time.Now().Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		expected := totpCode(key, uint64(counter+int64(i)))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConsumeTotpCode validates the code and makes sure it cannot be replayed
+// while it is still inside the accepted window.
+func ConsumeTotpCode(ctx context.Context, userId, secret, code string) (bool, error) {
+	if !ValidateTotpCode(secret, code) {
+		return false, nil
+	}
+
+	window := time.Second * totpPeriod * (2*totpSkew + 1)
+
+	return config.Redis.SetNX(ctx, "mfa_used_"+userId+"_"+code, true, window).Result()
+}
+
+func totpCode(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes returns plain codes in the xxxxx-xxxxx format; only
+// their hashes are persisted.
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		code, err := generateAlphaNumericToken(10)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// GenerateMfaChallenge issues the short lived token LoginUser hands out in
+// place of an access token when the user has two-factor enabled.
+func GenerateMfaChallenge(ctx context.Context, userId string) (string, error) {
+	challenge := uuid.New().String()
+	challengeKey := "mfa_challenge_" + challenge
+
+	_, err := config.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, challengeKey, "user_id", userId, "attempts", 0)
+		pipe.Expire(ctx, challengeKey, MfaChallengeExpiry)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+func GetMfaChallenge(ctx context.Context, challenge string) (string, error) {
+	userId, err := config.Redis.HGet(ctx, "mfa_challenge_"+challenge, "user_id").Result()
+	if err == redis.Nil {
+		return "", errors.ErrInvalidMfaChallenge
+	} else if err != nil {
+		return "", err
+	}
+	return userId, nil
+}
+
+// FailMfaChallenge records a wrong code and burns the challenge once too
+// many attempts were made against it.
+func FailMfaChallenge(ctx context.Context, challenge string) error {
+	challengeKey := "mfa_challenge_" + challenge
+
+	attempts, err := config.Redis.HIncrBy(ctx, challengeKey, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+
+	if attempts >= mfaChallengeMaxAttempts {
+		return config.Redis.Del(ctx, challengeKey).Err()
+	}
+	return nil
+}
+
+func DeleteMfaChallenge(ctx context.Context, challenge string) error {
+	return config.Redis.Del(ctx, "mfa_challenge_"+challenge).Err()
+}
@@ -0,0 +1,354 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dudeiebot/ad-ly/audit"
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+const TypeExportUser = "export:user"
+
+type ExportUserPayload struct {
+	UserId string
+}
+
+type exportedUser struct {
+	Id                 string     `json:"id"`
+	Name               string     `json:"name"`
+	Email              string     `json:"email"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+	DisabledAt         *time.Time `json:"disabled_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+type exportedSession struct {
+	Id         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IpAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type exportedIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportedApiKey struct {
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     string     `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type exportedPasskey struct {
+	Name       string     `json:"name"`
+	Synced     bool       `json:"synced"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type exportedMembership struct {
+	Organization string    `json:"organization"`
+	Role         string    `json:"role"`
+	JoinedAt     time.Time `json:"joined_at"`
+}
+
+type exportedActivity struct {
+	Action    string          `json:"action"`
+	IpAddress string          `json:"ip_address"`
+	UserAgent string          `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type exportedRecoveryCode struct {
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NewExportUserHandler builds the handler that archives everything stored
+// about a user and mails it to them. It takes the client the archive email
+// is enqueued on since the queue package registers this handler.
+func NewExportUserHandler(client *asynq.Client) asynq.HandlerFunc {
+	return func(ctx context.Context, t *asynq.Task) error {
+		var p ExportUserPayload
+
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("failed to Unmarshal payload: %w", err)
+		}
+
+		var user models.User
+		err := config.PostDb.WithContext(ctx).Where("id = ?", p.UserId).Find(&user).Error
+		if err != nil {
+			return err
+		}
+
+		if user.Empty() {
+			logger.Info("Skipping export for missing user", "user_id", p.UserId)
+			return nil
+		}
+
+		files, err := gatherUserData(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		archive, err := buildArchive(files)
+		if err != nil {
+			return err
+		}
+
+		return mailer.EnqueueEmailTask(client, mailer.EmailPayload{
+			TemplateName: "data_export",
+			To:           user.Email,
+			Subject:      "Your Data Export",
+			Data: map[string]interface{}{
+				"Name": user.Name,
+			},
+			Attachments: []*mailer.Attachment{{
+				Filename:    fmt.Sprintf("export-%s.zip", time.Now().Format("2006-01-02")),
+				ContentType: "application/zip",
+				Content:     archive,
+			}},
+		})
+	}
+}
+
+func EnqueueExportUserTask(client *asynq.Client, payload ExportUserPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeExportUser, data)
+
+	_, err = client.Enqueue(task)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	return nil
+}
+
+// gatherUserData returns the archive contents keyed by file name. Secrets
+// such as the password hash and totp secret are left out.
+func gatherUserData(ctx context.Context, user models.User) (map[string]interface{}, error) {
+	files := map[string]interface{}{
+		"user.json": exportedUser{
+			Id:                 user.Id,
+			Name:               user.Name,
+			Email:              user.Email,
+			EmailVerifiedAt:    user.EmailVerifiedAt,
+			TwoFactorEnabledAt: user.TwoFactorEnabledAt,
+			DisabledAt:         user.DisabledAt,
+			CreatedAt:          user.CreatedAt,
+			UpdatedAt:          user.UpdatedAt,
+		},
+	}
+
+	sessions, err := exportSessions(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	files["sessions.json"] = sessions
+
+	var recoveryCodes []models.RecoveryCode
+	err = config.PostDb.WithContext(ctx).Where("user_id = ?", user.Id).Find(&recoveryCodes).Error
+	if err != nil {
+		return nil, err
+	}
+	exportedCodes := make([]exportedRecoveryCode, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		exportedCodes = append(exportedCodes, exportedRecoveryCode{UsedAt: code.UsedAt, CreatedAt: code.CreatedAt})
+	}
+	files["recovery_codes.json"] = exportedCodes
+
+	var roles []models.Role
+	err = config.PostDb.WithContext(ctx).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", user.Id).
+		Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	roleNames := make([]string, 0, len(roles))
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+	}
+	files["roles.json"] = roleNames
+
+	var identities []models.LinkedIdentity
+	err = config.PostDb.WithContext(ctx).Where("user_id = ?", user.Id).Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	exportedIdentities := make([]exportedIdentity, 0, len(identities))
+	for _, identity := range identities {
+		exportedIdentities = append(exportedIdentities, exportedIdentity{
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+	files["linked_identities.json"] = exportedIdentities
+
+	var apiKeys []models.ApiKey
+	err = config.PostDb.WithContext(ctx).Where("user_id = ?", user.Id).Find(&apiKeys).Error
+	if err != nil {
+		return nil, err
+	}
+	exportedApiKeys := make([]exportedApiKey, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		exportedApiKeys = append(exportedApiKeys, exportedApiKey{
+			Name:       apiKey.Name,
+			Prefix:     apiKey.Prefix,
+			Scopes:     apiKey.Scopes,
+			ExpiresAt:  apiKey.ExpiresAt,
+			LastUsedAt: apiKey.LastUsedAt,
+			CreatedAt:  apiKey.CreatedAt,
+		})
+	}
+	files["api_keys.json"] = exportedApiKeys
+
+	var passkeys []models.Passkey
+	err = config.PostDb.WithContext(ctx).Where("user_id = ?", user.Id).Find(&passkeys).Error
+	if err != nil {
+		return nil, err
+	}
+	exportedPasskeys := make([]exportedPasskey, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exportedPasskeys = append(exportedPasskeys, exportedPasskey{
+			Name:       passkey.Name,
+			Synced:     passkey.BackupState,
+			LastUsedAt: passkey.LastUsedAt,
+			CreatedAt:  passkey.CreatedAt,
+		})
+	}
+	files["passkeys.json"] = exportedPasskeys
+
+	var exportedMemberships []exportedMembership
+	err = config.RunAsUser(ctx, user.Id, func(ctx context.Context) error {
+		var memberships []models.Membership
+		if err := config.TenantDb(ctx).Where("user_id = ?", user.Id).Find(&memberships).Error; err != nil {
+			return err
+		}
+		exportedMemberships = make([]exportedMembership, 0, len(memberships))
+		for _, membership := range memberships {
+			var organization models.Organization
+			err := config.TenantDb(ctx).Where("id = ?", membership.OrganizationId).Find(&organization).Error
+			if err != nil {
+				return err
+			}
+			exportedMemberships = append(exportedMemberships, exportedMembership{
+				Organization: organization.Name,
+				Role:         membership.Role,
+				JoinedAt:     membership.CreatedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	files["memberships.json"] = exportedMemberships
+
+	var events []models.AuditEvent
+	err = config.PostDb.WithContext(ctx).
+		Where("actor_id = ? OR (target_type = ? AND target_id = ?)", user.Id, audit.TargetUser, user.Id).
+		Order("created_at").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	exportedEvents := make([]exportedActivity, 0, len(events))
+	for _, event := range events {
+		exportedEvents = append(exportedEvents, exportedActivity{
+			Action:    event.Action,
+			IpAddress: event.IpAddress,
+			UserAgent: event.UserAgent,
+			Metadata:  json.RawMessage(event.Metadata),
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	files["activity.json"] = exportedEvents
+
+	return files, nil
+}
+
+// exportSessions reads the session index helpers.GenerateAccessToken keeps
+// in redis.
+func exportSessions(ctx context.Context, userId string) ([]exportedSession, error) {
+	familyIds, err := config.Redis.SMembers(ctx, "user_sessions_"+userId).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]exportedSession, 0, len(familyIds))
+	for _, familyId := range familyIds {
+		meta, err := config.Redis.HGetAll(ctx, "user_session_"+familyId).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(meta) == 0 {
+			continue
+		}
+
+		createdAt, _ := strconv.ParseInt(meta["created_at"], 10, 64)
+		lastSeenAt, _ := strconv.ParseInt(meta["last_seen_at"], 10, 64)
+
+		sessions = append(sessions, exportedSession{
+			Id:         familyId,
+			UserAgent:  meta["user_agent"],
+			IpAddress:  meta["ip_address"],
+			CreatedAt:  time.Unix(createdAt, 0),
+			LastSeenAt: time.Unix(lastSeenAt, 0),
+		})
+	}
+
+	return sessions, nil
+}
+
+func buildArchive(files map[string]interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+
+	for name, content := range files {
+		data, err := json.MarshalIndent(content, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := writer.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
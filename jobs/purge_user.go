@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Dudeiebot/dlog"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+var logger = dlog.NewLog(dlog.LevelTrace)
+
+const TypePurgeUser = "purge:user"
+
+type PurgeUserPayload struct {
+	UserId string
+}
+
+// HandlePurgeUserTask hard deletes a soft deleted user and everything
+// stored against them. Logging back in during the grace period clears
+// deleted_at, in which case the task does nothing.
+func HandlePurgeUserTask(ctx context.Context, t *asynq.Task) error {
+	var p PurgeUserPayload
+
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to Unmarshal payload: %w", err)
+	}
+
+	var user models.User
+	err := config.PostDb.WithContext(ctx).Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", p.UserId).
+		Find(&user).Error
+	if err != nil {
+		return err
+	}
+
+	if user.Empty() || time.Since(user.DeletedAt.Time) < config.AuthConfig.DeletionGracePeriod {
+		logger.Info("Skipping purge for restored user", "user_id", p.UserId)
+		return nil
+	}
+
+	// the user's memberships are only visible on their behalf under row
+	// level security
+	err = config.RunAsUser(ctx, user.Id, func(ctx context.Context) error {
+		return config.TenantDb(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", user.Id).Delete(&models.RecoveryCode{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.Id).Delete(&models.UserRole{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.Id).Delete(&models.LinkedIdentity{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.Id).Delete(&models.ApiKey{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.Id).Delete(&models.Passkey{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.Id).Delete(&models.Membership{}).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Where("id = ?", user.Id).Delete(&models.User{}).Error
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Purged user", "user_id", p.UserId)
+	return nil
+}
+
+func EnqueuePurgeUserTask(client *asynq.Client, payload PurgeUserPayload, delay time.Duration) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypePurgeUser, data)
+
+	_, err = client.Enqueue(task, asynq.ProcessIn(delay))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	return nil
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
 	"github.com/dudeiebot/ad-ly/helpers"
 	"github.com/dudeiebot/ad-ly/models"
 )
@@ -14,14 +16,80 @@ import (
 type userCtxKey string
 
 const (
-	userKey userCtxKey = "user"
+	userKey    userCtxKey = "user"
+	sessionKey userCtxKey = "session"
 )
 
+// authUser resolves the authenticated user and their roles at most once
+// per request, and only once something asks for them.
+type authUser struct {
+	id        string
+	userOnce  sync.Once
+	user      models.User
+	rolesOnce sync.Once
+	roles     []models.Role
+	// set when the request was made with an api key instead of a token
+	apiKey *models.ApiKey
+	// the admin behind an impersonation token
+	actorId string
+}
+
+func (a *authUser) loadUser(ctx context.Context) models.User {
+	a.userOnce.Do(func() {
+		_ = config.PostDb.WithContext(ctx).Where("id = ?", a.id).First(&a.user).Error
+	})
+	return a.user
+}
+
+func (a *authUser) loadRoles(ctx context.Context) []models.Role {
+	a.rolesOnce.Do(func() {
+		a.roles, _ = loadRoles(ctx, a.id)
+	})
+	return a.roles
+}
+
+// AuthenticateUser accepts an X-API-Key header, or else takes the access
+// token from the Authorization header or the access_token cookie. It looks the token up in redis and loads the user
+// up front, unless AUTH_TOKEN_MODE is stateless: then the token is trusted
+// on its signature and the denylist, and the user is only loaded when a
+// handler calls GetUser. Disabled and deleted users are then kept out by
+// the denylist alone, see services.DisableUser.
 func AuthenticateUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unauthorized := helpers.Message("Unauthorized")
+
+		if key := r.Header.Get(helpers.ApiKeyHeader); key != "" {
+			authenticated, ok := authenticateApiKey(r.Context(), key)
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(unauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userKey, authenticated)
+			ctx = context.WithValue(ctx, sessionKey, "")
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		token := strings.Replace(r.Header.Get("Authorization"), "Bearer ", "", -1)
 
-		unauthorized := helpers.Message("Unauthorized")
+		// browsers send the cookie on their own, so a cookie alone does not
+		// prove the request came from our frontend
+		if token == "" {
+			if cookie, err := r.Cookie(helpers.AccessTokenCookie); err == nil {
+				token = cookie.Value
+
+				if !helpers.ValidCsrf(r) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusForbidden)
+					_ = json.NewEncoder(w).Encode(helpers.Message(errors.ErrInvalidCsrfToken.Error()))
+					return
+				}
+			}
+		}
 
 		if token == "" {
 			w.Header().Set("Content/Type", "application/json")
@@ -30,17 +98,37 @@ func AuthenticateUser(next http.Handler) http.Handler {
 			return
 		}
 
+		if config.AuthConfig.StatelessTokens {
+			claims, err := helpers.ParseStatelessAccessToken(r.Context(), token)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(unauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userKey, &authUser{id: claims.UserId, actorId: claims.ActorId})
+			ctx = context.WithValue(ctx, sessionKey, claims.SessionId)
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		tempToken, _ := helpers.ParseAccessToken(token)
 		var foundUser models.User
 
-		if tempToken == "" {
-			tempToken = ""
+		// revoked or expired tokens no longer have a session in redis
+		session := config.Redis.HGetAll(r.Context(), "user_auth_"+tempToken).Val()
+		if tempToken == "" || session["user_id"] == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(unauthorized)
+			return
 		}
 
-		userId := config.Redis.Get(r.Context(), "user_auth_"+tempToken).Val()
-		_ = config.PostDb.Where("id = ?", userId).First(&foundUser).Error
+		_ = config.PostDb.Where("id = ?", session["user_id"]).First(&foundUser).Error
 
-		if foundUser.Empty() {
+		if foundUser.Empty() || foundUser.Disabled() {
 			w.Header().Set("Content-Type", "application/json")
 
 			w.WriteHeader(http.StatusUnauthorized)
@@ -49,15 +137,35 @@ func AuthenticateUser(next http.Handler) http.Handler {
 
 			return
 		}
-		r = r.WithContext(context.WithValue(r.Context(), userKey, foundUser))
+
+		_ = helpers.TouchSession(r.Context(), session["family_id"], helpers.DeviceFromRequest(r))
+
+		// the user is already loaded, so GetUser must not fetch it again
+		authenticated := &authUser{id: foundUser.Id, user: foundUser, actorId: session["actor_id"]}
+		authenticated.userOnce.Do(func() {})
+
+		ctx := context.WithValue(r.Context(), userKey, authenticated)
+		ctx = context.WithValue(ctx, sessionKey, session["family_id"])
+		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// GetUser returns the authenticated user, loading it on first use.
 func GetUser(ctx context.Context) models.User {
-	return ctx.Value(userKey).(models.User)
+	return ctx.Value(userKey).(*authUser).loadUser(ctx)
+}
+
+// GetUserId returns the authenticated user's id without loading the user.
+func GetUserId(ctx context.Context) string {
+	return ctx.Value(userKey).(*authUser).id
+}
+
+// GetSessionId returns the token family the current request was authenticated with.
+func GetSessionId(ctx context.Context) string {
+	return ctx.Value(sessionKey).(string)
 }
 
 func IsUser(ctx context.Context, user models.User) bool {
-	return ctx.Value(userKey).(models.User).Id == user.Id
+	return GetUserId(ctx) == user.Id
 }
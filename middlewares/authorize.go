@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+// RequirePermission only lets the request through when one of the
+// authenticated user's roles grants the permission. It has to run after
+// AuthenticateUser.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(r.Context(), permission) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(helpers.Message("Forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetRoles returns the authenticated user's roles, loading them on first use.
+func GetRoles(ctx context.Context) []models.Role {
+	authenticated, ok := ctx.Value(userKey).(*authUser)
+	if !ok {
+		return nil
+	}
+	return authenticated.loadRoles(ctx)
+}
+
+func HasRole(ctx context.Context, name string) bool {
+	for _, role := range GetRoles(ctx) {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the user's roles grant the permission. An
+// api key additionally has to carry the permission as one of its scopes.
+func HasPermission(ctx context.Context, permission string) bool {
+	if apiKey := GetApiKey(ctx); apiKey != nil && !apiKey.HasScope(permission) {
+		return false
+	}
+
+	for _, role := range GetRoles(ctx) {
+		if role.HasPermission(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadRoles(ctx context.Context, userId string) ([]models.Role, error) {
+	var roles []models.Role
+
+	err := config.PostDb.WithContext(ctx).
+		Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Find(&roles).Error
+
+	return roles, err
+}
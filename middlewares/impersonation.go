@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+// RejectImpersonation keeps an admin acting as a user away from actions
+// only the user may take, such as changing their credentials or deleting
+// the account.
+func RejectImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsImpersonating(r.Context()) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(helpers.Message(errors.ErrImpersonationForbidden.Error()))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsImpersonating reports whether the request was made with an
+// impersonation token. GetUser still returns the impersonated user.
+func IsImpersonating(ctx context.Context) bool {
+	return GetActorId(ctx) != ""
+}
+
+// GetActorId returns the id of the admin behind an impersonation token, or
+// an empty string when the user is acting for themselves.
+func GetActorId(ctx context.Context) string {
+	authenticated, ok := ctx.Value(userKey).(*authUser)
+	if !ok {
+		return ""
+	}
+	return authenticated.actorId
+}
+
+// GetActor returns the admin behind an impersonation token, loaded on
+// every call since only the impersonation routes ask for it.
+func GetActor(ctx context.Context) models.User {
+	var actor models.User
+	if actorId := GetActorId(ctx); actorId != "" {
+		_ = config.PostDb.WithContext(ctx).Where("id = ?", actorId).First(&actor).Error
+	}
+	return actor
+}
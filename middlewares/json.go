@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/dudeiebot/ad-ly/helpers"
 )
@@ -38,3 +39,17 @@ func ValidateJson(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// ValidateForm takes the place of ValidateJson on the oauth token endpoint,
+// which clients speak to in form encoding.
+func ValidateForm(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(helpers.Message("Invalid Form Format"))
+
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+const (
+	OrganizationHeader = "X-Organization-Id"
+
+	organizationKey userCtxKey = "organization"
+)
+
+type currentOrganization struct {
+	organization models.Organization
+	membership   models.Membership
+}
+
+// ResolveOrganization loads the organization named by the {org} path
+// parameter, or else the X-Organization-Id header, along with the
+// authenticated user's membership of it. Organizations the user is not a
+// member of answer 404, the same as ones that do not exist. The lookups run
+// in the organization's tenant and the rest of the chain gets it in its
+// context; handlers reach the database through config.InTenant, which only
+// holds a transaction while it runs. It has to run after AuthenticateUser.
+func ResolveOrganization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		organizationId := chi.URLParam(r, "org")
+		if organizationId == "" {
+			organizationId = r.Header.Get(OrganizationHeader)
+		}
+
+		if organizationId == "" {
+			organizationNotFound(w)
+			return
+		}
+
+		current := &currentOrganization{}
+
+		// run in the tenant asked for, so the policies let the lookups through
+		err := config.RunInTenant(r.Context(), organizationId, func(ctx context.Context) error {
+			err := config.TenantDb(ctx).
+				Where("organization_id = ? AND user_id = ?", organizationId, GetUserId(ctx)).
+				Limit(1).Find(&current.membership).Error
+			if err != nil || current.membership.Empty() {
+				return err
+			}
+			return config.TenantDb(ctx).
+				Where("id = ?", organizationId).
+				Limit(1).Find(&current.organization).Error
+		})
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(helpers.Message(helpers.ServerError(err).Error()))
+			return
+		}
+
+		if current.organization.Empty() {
+			organizationNotFound(w)
+			return
+		}
+
+		// from here on queries on tenant scoped models only see this organization
+		ctx := config.WithTenant(context.WithValue(r.Context(), organizationKey, current), organizationId)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func organizationNotFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(helpers.Message(errors.ErrOrganizationNotFound.Error()))
+}
+
+// RequireOrgRole only lets members holding role, or a role above it,
+// through. It has to run after ResolveOrganization.
+func RequireOrgRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			membership := GetMembership(r.Context())
+			if !membership.AtLeast(role) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(helpers.Message("Forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetOrganization returns the organization resolved for the request.
+func GetOrganization(ctx context.Context) models.Organization {
+	current, ok := ctx.Value(organizationKey).(*currentOrganization)
+	if !ok {
+		return models.Organization{}
+	}
+	return current.organization
+}
+
+// GetMembership returns the authenticated user's membership of the
+// organization resolved for the request.
+func GetMembership(ctx context.Context) models.Membership {
+	current, ok := ctx.Value(organizationKey).(*currentOrganization)
+	if !ok {
+		return models.Membership{}
+	}
+	return current.membership
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// ApiKey lets a user's servers call the api without one of their tokens.
+// Prefix is the visible part of the key used to look it up; only a hash
+// of the secret part is stored. Scopes are space separated.
+type ApiKey struct {
+	Id         string
+	UserId     string
+	Name       string
+	Prefix     string
+	SecretHash string
+	Scopes     string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (k *ApiKey) Empty() bool {
+	return k.Id == ""
+}
+
+func (k *ApiKey) Expired() bool {
+	return k.ExpiresAt != nil && k.ExpiresAt.Before(time.Now())
+}
+
+func (k *ApiKey) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(k.Scopes), scope)
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AuditEvent is one entry of the append only audit trail. ActorId is
+// empty when nobody was signed in, e.g. a failed login. Metadata holds a
+// JSON object.
+type AuditEvent struct {
+	Id         string
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	IpAddress  string
+	UserAgent  string
+	RequestId  string
+	Metadata   string
+	CreatedAt  time.Time
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Impersonation records an admin acting as a user, from the moment the
+// token was minted until its session was revoked or expired. SessionId is
+// the token family the impersonation runs in, ExpiresAt when its latest
+// refresh token runs out.
+type Impersonation struct {
+	Id        string
+	ActorId   string
+	UserId    string
+	SessionId string
+	Reason    string
+	IpAddress string
+	UserAgent string
+	StartedAt time.Time
+	ExpiresAt time.Time
+	EndedAt   *time.Time
+}
+
+// End is when the impersonation ended, nil while it is still running. A
+// session left to expire is never revoked, so its expiry stands in.
+func (impersonation Impersonation) End() *time.Time {
+	if impersonation.EndedAt == nil && time.Now().After(impersonation.ExpiresAt) {
+		return &impersonation.ExpiresAt
+	}
+	return impersonation.EndedAt
+}
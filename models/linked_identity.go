@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type LinkedIdentity struct {
+	Id        string
+	UserId    string
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
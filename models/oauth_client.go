@@ -0,0 +1,50 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// OAuthClient is an application allowed to sign users in through our own
+// OpenID Connect provider. RedirectUris, GrantTypes and Scopes are stored
+// space separated, the same way scopes travel over the wire.
+type OAuthClient struct {
+	Id           string
+	Name         string
+	SecretHash   string
+	RedirectUris string
+	GrantTypes   string
+	Scopes       string
+	Public       bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+func (c *OAuthClient) Empty() bool {
+	return c.Id == ""
+}
+
+func (c *OAuthClient) AllowsRedirectUri(uri string) bool {
+	return slices.Contains(strings.Fields(c.RedirectUris), uri)
+}
+
+func (c *OAuthClient) AllowsGrantType(grantType string) bool {
+	return slices.Contains(strings.Fields(c.GrantTypes), grantType)
+}
+
+// AllowsScopes reports whether every space separated scope in requested
+// was registered for the client.
+func (c *OAuthClient) AllowsScopes(requested string) bool {
+	allowed := strings.Fields(c.Scopes)
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
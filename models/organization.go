@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// orgRoleRanks orders the roles, so a member can only hand out roles up
+// to their own.
+var orgRoleRanks = map[string]int{
+	OrgRoleMember: 1,
+	OrgRoleAdmin:  2,
+	OrgRoleOwner:  3,
+}
+
+// Organization is a team of users. Every organization has exactly one
+// membership with the owner role.
+type Organization struct {
+	Id        string
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Membership struct {
+	Id             string
+	OrganizationId string
+	UserId         string
+	Role           string
+	User           User `gorm:"foreignKey:UserId"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Invitation asks whoever owns Email to join the organization. Only a hash
+// of the emailed token is stored.
+type Invitation struct {
+	Id             string
+	OrganizationId string
+	Email          string
+	Role           string
+	TokenHash      string
+	InvitedBy      string
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+// TenantColumn scopes organizations, their memberships and invitations to
+// the tenant a request was resolved to; see config.TenantScoped.
+func (Organization) TenantColumn() string {
+	return "id"
+}
+
+func (Membership) TenantColumn() string {
+	return "organization_id"
+}
+
+func (Invitation) TenantColumn() string {
+	return "organization_id"
+}
+
+func (o *Organization) Empty() bool {
+	return o.Id == ""
+}
+
+func (m *Membership) Empty() bool {
+	return m.Id == ""
+}
+
+// CanManage reports whether the member may invite and remove members.
+func (m *Membership) CanManage() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleAdmin
+}
+
+// Outranks reports whether the member's role is above role.
+func (m *Membership) Outranks(role string) bool {
+	return orgRoleRanks[m.Role] > orgRoleRanks[role]
+}
+
+// AtLeast reports whether the member's role is role or above it.
+func (m *Membership) AtLeast(role string) bool {
+	return orgRoleRanks[m.Role] >= orgRoleRanks[role]
+}
+
+func (i *Invitation) Expired() bool {
+	return i.ExpiresAt.Before(time.Now())
+}
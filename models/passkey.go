@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential registered by a user. CredentialId is
+// the raw credential id, base64url encoded; Transports are space separated.
+type Passkey struct {
+	Id              string
+	UserId          string
+	Name            string
+	CredentialId    string
+	PublicKey       []byte
+	AttestationType string
+	Transports      string
+	Aaguid          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
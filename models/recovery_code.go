@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type RecoveryCode struct {
+	Id        string
+	UserId    string
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
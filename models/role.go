@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type Role struct {
+	Id          string
+	Name        string
+	Description string
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Permission struct {
+	Id          string
+	Name        string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type UserRole struct {
+	UserId    string
+	RoleId    string
+	CreatedAt time.Time
+}
+
+func (r *Role) HasPermission(name string) bool {
+	for _, permission := range r.Permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
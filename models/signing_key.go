@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SigningKey is a key pair used to sign our JWTs; its Id is the kid put in
+// the token header. A key is published from creation but only signs from
+// ActivatesAt. Retired keys can no longer sign but keep verifying until
+// every token signed with them has expired. PrivateKey is sealed with the
+// app key.
+type SigningKey struct {
+	Id          string
+	Algorithm   string
+	PrivateKey  string
+	PublicKey   string
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	RetiredAt   *time.Time
+}
@@ -8,13 +8,16 @@ import (
 
 type User struct {
 	gorm.Model
-	Id              string
-	Name            string
-	Password        string
-	Email           string
-	EmailVerifiedAt *time.Time
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	Id                 string
+	Name               string
+	Password           string
+	Email              string
+	EmailVerifiedAt    *time.Time
+	TwoFactorSecret    string
+	TwoFactorEnabledAt *time.Time
+	DisabledAt         *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
 }
 
 func (u *User) Empty() bool {
@@ -30,3 +33,17 @@ func (u *User) EmailVerified() bool {
 	}
 	return false
 }
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactorEnabledAt != nil && !u.TwoFactorEnabledAt.IsZero()
+}
+
+// HasPassword is false for accounts made through an oauth provider until
+// the user sets a password of their own.
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil && !u.DisabledAt.IsZero()
+}
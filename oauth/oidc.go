@@ -0,0 +1,118 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OidcProvider signs users in with any OpenID Connect issuer using the
+// authorization code flow with PKCE. The issuer's discovery document is
+// only fetched on first use so an unreachable provider cannot keep the
+// server from starting.
+type OidcProvider struct {
+	name         string
+	issuer       string
+	clientId     string
+	clientSecret string
+	redirectUrl  string
+
+	mu       sync.Mutex
+	config   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOidcProvider(name, issuer, clientId, clientSecret, redirectUrl string) *OidcProvider {
+	return &OidcProvider{
+		name:         name,
+		issuer:       issuer,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		redirectUrl:  redirectUrl,
+	}
+}
+
+func (p *OidcProvider) Name() string {
+	return p.name
+}
+
+func (p *OidcProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *OidcProvider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	config, idTokenVerifier, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return Identity{}, err
+	}
+
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+
+	idToken, err := idTokenVerifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if idToken.Nonce != nonce {
+		return Identity{}, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *OidcProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config != nil {
+		return p.config, p.verifier, nil
+	}
+
+	// the provider keeps this context around to refresh the issuer's keys,
+	// so it must outlive the request that triggered discovery
+	provider, err := oidc.NewProvider(context.WithoutCancel(ctx), p.issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.config = &oauth2.Config{
+		ClientID:     p.clientId,
+		ClientSecret: p.clientSecret,
+		RedirectURL:  p.redirectUrl,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.clientId})
+
+	return p.config, p.verifier, nil
+}
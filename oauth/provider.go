@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dudeiebot/ad-ly/config"
+)
+
+// Identity is what a provider tells us about the user who signed in.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an external identity provider users can sign in with.
+type Provider interface {
+	Name() string
+	// AuthCodeURL returns where to send the user to sign in. The verifier
+	// is the PKCE code verifier the challenge is derived from.
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange trades the authorization code for the signed in identity.
+	Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error)
+}
+
+var (
+	providers   = map[string]Provider{}
+	providersMu sync.RWMutex
+)
+
+func Register(provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[provider.Name()] = provider
+}
+
+func Get(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// RegisterConfiguredProviders registers an OIDC provider for every entry in
+// config.OAuthConfig.
+func RegisterConfiguredProviders() {
+	apiHost := config.GetApiHost()
+
+	for _, provider := range config.OAuthConfig.Providers {
+		Register(NewOidcProvider(
+			provider.Name,
+			provider.Issuer,
+			provider.ClientId,
+			provider.ClientSecret,
+			fmt.Sprintf("%s/auth/oauth/%s/callback", apiHost, provider.Name),
+		))
+	}
+}
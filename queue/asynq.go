@@ -6,7 +6,9 @@ import (
 
 	"github.com/hibiken/asynq"
 
+	"github.com/dudeiebot/ad-ly/audit"
 	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/jobs"
 	"github.com/dudeiebot/ad-ly/mailer"
 )
 
@@ -32,5 +34,14 @@ func Register() *asynq.ServeMux {
 	// SEND EMAIL
 	mux.HandleFunc("send:email", mailer.HandleSendEmailTask)
 
+	// PURGE DELETED USERS
+	mux.HandleFunc(jobs.TypePurgeUser, jobs.HandlePurgeUserTask)
+
+	// EXPORT USER DATA
+	mux.HandleFunc(jobs.TypeExportUser, jobs.NewExportUserHandler(Client))
+
+	// AUDIT TRAIL
+	mux.HandleFunc(audit.TypeRecordEvent, audit.HandleRecordEventTask)
+
 	return mux
 }
@@ -0,0 +1,32 @@
+package request
+
+type ListUsers struct {
+	Cursor      string `json:"cursor"`
+	Limit       string `json:"limit"`
+	Email       string `json:"email"`
+	Verified    string `json:"verified"`
+	CreatedFrom string `json:"created_from"`
+	CreatedTo   string `json:"created_to"`
+	Sort        string `json:"sort"`
+}
+
+type UpdateUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type StartImpersonation struct {
+	Reason string `json:"reason"`
+}
+
+type ListAuditEvents struct {
+	Cursor     string `json:"cursor"`
+	Limit      string `json:"limit"`
+	ActorId    string `json:"actor_id"`
+	Action     string `json:"action"`
+	TargetType string `json:"target_type"`
+	TargetId   string `json:"target_id"`
+	RequestId  string `json:"request_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
@@ -23,3 +23,37 @@ type PostForgot struct {
 type VerifyUser struct {
 	Token string `json:"token"`
 }
+
+type RefreshToken struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type VerifyMfa struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MagicLink struct {
+	Email string `json:"email"`
+}
+
+type ConsumeMagicLink struct {
+	Token string `json:"token"`
+}
+
+type UnlockAccount struct {
+	Token string `json:"token"`
+}
+
+type DisownLogin struct {
+	Token string `json:"token"`
+}
+
+type ResendVerification struct {
+	Email string `json:"email"`
+}
+
+type VerifyCode struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
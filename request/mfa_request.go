@@ -0,0 +1,10 @@
+package request
+
+type ConfirmMfa struct {
+	Code string `json:"code"`
+}
+
+type DisableMfa struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
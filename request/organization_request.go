@@ -0,0 +1,22 @@
+package request
+
+type CreateOrganization struct {
+	Name string `json:"name"`
+}
+
+type InviteMember struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type UpdateMember struct {
+	Role string `json:"role"`
+}
+
+type TransferOwnership struct {
+	UserId string `json:"user_id"`
+}
+
+type InvitationToken struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,18 @@
+package request
+
+import "encoding/json"
+
+// FinishPasskeyRegistration carries the authenticator's attestation as
+// returned by navigator.credentials.create.
+type FinishPasskeyRegistration struct {
+	ChallengeId string          `json:"challenge_id"`
+	Name        string          `json:"name"`
+	Credential  json.RawMessage `json:"credential"`
+}
+
+// FinishPasskeyLogin carries the authenticator's assertion as returned by
+// navigator.credentials.get.
+type FinishPasskeyLogin struct {
+	ChallengeId string          `json:"challenge_id"`
+	Credential  json.RawMessage `json:"credential"`
+}
@@ -0,0 +1,35 @@
+package request
+
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+
+type ChangeEmail struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ConfirmEmailChange struct {
+	Token string `json:"token"`
+}
+
+type DeleteUser struct {
+	Password string `json:"password"`
+}
+
+type CreateApiKey struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at"`
+}
+
+type UpdateApiKey struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type GetActivity struct {
+	Cursor string `json:"cursor"`
+	Limit  string `json:"limit"`
+}
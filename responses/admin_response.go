@@ -0,0 +1,22 @@
+package responses
+
+import (
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+type AdminUserResponse struct {
+	UserResponse
+	Disabled bool `json:"disabled"`
+}
+
+type AdminUserListResponse struct {
+	Data       []AdminUserResponse `json:"data"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+func GenerateAdminUserResponse(user models.User) AdminUserResponse {
+	return AdminUserResponse{
+		UserResponse: GenerateUserResponse(user),
+		Disabled:     user.Disabled(),
+	}
+}
@@ -0,0 +1,40 @@
+package responses
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+type ApiKeyResponse struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Key        string   `json:"key,omitempty"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  *string  `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+func GenerateApiKeyResponse(apiKey models.ApiKey) ApiKeyResponse {
+	return ApiKeyResponse{
+		Id:         apiKey.Id,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     strings.Fields(apiKey.Scopes),
+		ExpiresAt:  optionalJsonTime(apiKey.ExpiresAt),
+		LastUsedAt: optionalJsonTime(apiKey.LastUsedAt),
+		CreatedAt:  helpers.JSONTime{Time: apiKey.CreatedAt}.Json(),
+	}
+}
+
+func optionalJsonTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := helpers.JSONTime{Time: *t}.Json()
+	return &formatted
+}
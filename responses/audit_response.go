@@ -0,0 +1,46 @@
+package responses
+
+import (
+	"encoding/json"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+type AuditEventResponse struct {
+	Id         string          `json:"id"`
+	ActorId    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetId   string          `json:"target_id"`
+	IpAddress  string          `json:"ip_address"`
+	UserAgent  string          `json:"user_agent"`
+	RequestId  string          `json:"request_id"`
+	Metadata   json.RawMessage `json:"metadata"`
+	CreatedAt  string          `json:"created_at"`
+}
+
+type AuditEventListResponse struct {
+	Data       []AuditEventResponse `json:"data"`
+	NextCursor string               `json:"next_cursor"`
+}
+
+func GenerateAuditEventResponse(event models.AuditEvent) AuditEventResponse {
+	metadata := json.RawMessage(event.Metadata)
+	if !json.Valid(metadata) {
+		metadata = json.RawMessage("{}")
+	}
+
+	return AuditEventResponse{
+		Id:         event.Id,
+		ActorId:    event.ActorId,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetId:   event.TargetId,
+		IpAddress:  event.IpAddress,
+		UserAgent:  event.UserAgent,
+		RequestId:  event.RequestId,
+		Metadata:   metadata,
+		CreatedAt:  helpers.JSONTime{Time: event.CreatedAt}.Json(),
+	}
+}
@@ -1,6 +1,49 @@
 package responses
 
+import (
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token        string        `json:"token,omitempty"`
+	RefreshToken string        `json:"refresh_token,omitempty"`
+	ExpiresIn    int64         `json:"expires_in,omitempty"`
+	MfaRequired  bool          `json:"mfa_required"`
+	MfaToken     string        `json:"mfa_token,omitempty"`
+	User         *UserResponse `json:"user,omitempty"`
+}
+
+type CsrfResponse struct {
+	CsrfToken string `json:"csrf_token"`
+}
+
+type MfaSetupResponse struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func GenerateAuthResponse(token helpers.AuthToken, user models.User) AuthResponse {
+	userResponse := GenerateUserResponse(user)
+
+	return AuthResponse{
+		Token:        token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresIn:    token.ExpiresIn,
+		User:         &userResponse,
+	}
+}
+
+// GenerateMfaChallengeResponse is returned by login in place of tokens when
+// the user still has to pass the second factor.
+func GenerateMfaChallengeResponse(challenge string) AuthResponse {
+	return AuthResponse{
+		MfaRequired: true,
+		MfaToken:    challenge,
+		ExpiresIn:   int64(helpers.MfaChallengeExpiry.Seconds()),
+	}
 }
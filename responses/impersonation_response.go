@@ -0,0 +1,30 @@
+package responses
+
+import (
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+type ImpersonationResponse struct {
+	Id        string  `json:"id"`
+	ActorId   string  `json:"actor_id"`
+	UserId    string  `json:"user_id"`
+	Reason    string  `json:"reason"`
+	IpAddress string  `json:"ip_address"`
+	UserAgent string  `json:"user_agent"`
+	StartedAt string  `json:"started_at"`
+	EndedAt   *string `json:"ended_at"`
+}
+
+func GenerateImpersonationResponse(impersonation models.Impersonation) ImpersonationResponse {
+	return ImpersonationResponse{
+		Id:        impersonation.Id,
+		ActorId:   impersonation.ActorId,
+		UserId:    impersonation.UserId,
+		Reason:    impersonation.Reason,
+		IpAddress: impersonation.IpAddress,
+		UserAgent: impersonation.UserAgent,
+		StartedAt: helpers.JSONTime{Time: impersonation.StartedAt}.Json(),
+		EndedAt:   optionalJsonTime(impersonation.End()),
+	}
+}
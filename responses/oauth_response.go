@@ -0,0 +1,26 @@
+package responses
+
+import (
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+type OAuthRedirectResponse struct {
+	AuthorizationUrl string `json:"authorization_url"`
+	// set as the oauth_state cookie by the controller
+	State string `json:"-"`
+}
+
+type LinkedIdentityResponse struct {
+	Provider  string `json:"provider"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
+
+func GenerateLinkedIdentityResponse(identity models.LinkedIdentity) LinkedIdentityResponse {
+	return LinkedIdentityResponse{
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: helpers.JSONTime{Time: identity.CreatedAt}.Json(),
+	}
+}
@@ -0,0 +1,87 @@
+package responses
+
+import (
+	"errors"
+	"strings"
+
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+type OpenIdConfigurationResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksUri                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type JwksResponse struct {
+	Keys []helpers.JsonWebKey `json:"keys"`
+}
+
+type AuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IdToken     string `json:"id_token,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+type OAuthClientResponse struct {
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	RedirectUris []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+func GenerateOAuthClientResponse(client models.OAuthClient) OAuthClientResponse {
+	return OAuthClientResponse{
+		ClientId:     client.Id,
+		Name:         client.Name,
+		RedirectUris: strings.Fields(client.RedirectUris),
+		GrantTypes:   strings.Fields(client.GrantTypes),
+		Scopes:       strings.Fields(client.Scopes),
+		Public:       client.Public,
+		CreatedAt:    helpers.JSONTime{Time: client.CreatedAt}.Json(),
+	}
+}
+
+// the token endpoint answers in the shape RFC 6749 section 5.2 expects
+// instead of our usual message body
+var oauthErrorCodes = map[error]string{
+	customizedError.ErrInvalidClient:         "invalid_client",
+	customizedError.ErrInvalidGrant:          "invalid_grant",
+	customizedError.ErrInvalidScope:          "invalid_scope",
+	customizedError.ErrUnauthorizedClient:    "unauthorized_client",
+	customizedError.ErrUnsupportedGrantType:  "unsupported_grant_type",
+	customizedError.ErrCodeChallengeRequired: "invalid_request",
+	customizedError.ErrInvalidRedirectUri:    "invalid_request",
+}
+
+func GenerateOAuthError(err error) map[string]string {
+	for known, code := range oauthErrorCodes {
+		if errors.Is(err, known) {
+			return map[string]string{"error": code, "error_description": err.Error()}
+		}
+	}
+
+	return map[string]string{"error": "server_error", "error_description": err.Error()}
+}
@@ -0,0 +1,64 @@
+package responses
+
+import (
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+type OrganizationResponse struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+}
+
+type MemberResponse struct {
+	UserId   string `json:"user_id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
+
+type InvitationResponse struct {
+	Id               string `json:"id"`
+	OrganizationId   string `json:"organization_id"`
+	OrganizationName string `json:"organization_name"`
+	Email            string `json:"email"`
+	Role             string `json:"role"`
+	ExpiresAt        string `json:"expires_at"`
+	CreatedAt        string `json:"created_at"`
+}
+
+// GenerateOrganizationResponse describes the organization as seen by a
+// member holding role.
+func GenerateOrganizationResponse(organization models.Organization, role string) OrganizationResponse {
+	return OrganizationResponse{
+		Id:        organization.Id,
+		Name:      organization.Name,
+		Role:      role,
+		CreatedAt: helpers.JSONTime{Time: organization.CreatedAt}.Json(),
+	}
+}
+
+func GenerateMemberResponse(membership models.Membership) MemberResponse {
+	return MemberResponse{
+		UserId:   membership.UserId,
+		Name:     membership.User.Name,
+		Email:    membership.User.Email,
+		Role:     membership.Role,
+		JoinedAt: helpers.JSONTime{Time: membership.CreatedAt}.Json(),
+	}
+}
+
+func GenerateInvitationResponse(invitation models.Invitation, organization models.Organization) InvitationResponse {
+	return InvitationResponse{
+		Id:               invitation.Id,
+		OrganizationId:   organization.Id,
+		OrganizationName: organization.Name,
+		Email:            invitation.Email,
+		Role:             invitation.Role,
+		ExpiresAt:        helpers.JSONTime{Time: invitation.ExpiresAt}.Json(),
+		CreatedAt:        helpers.JSONTime{Time: invitation.CreatedAt}.Json(),
+	}
+}
@@ -0,0 +1,42 @@
+package responses
+
+import (
+	"github.com/go-webauthn/webauthn/protocol"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+// PasskeyChallengeResponse hands the client the options for
+// navigator.credentials.create or .get; challenge_id has to be sent back
+// with the result.
+type PasskeyChallengeResponse struct {
+	ChallengeId string      `json:"challenge_id"`
+	Options     interface{} `json:"options"`
+}
+
+func GeneratePasskeyRegistrationResponse(challengeId string, options *protocol.CredentialCreation) PasskeyChallengeResponse {
+	return PasskeyChallengeResponse{ChallengeId: challengeId, Options: options}
+}
+
+func GeneratePasskeyLoginResponse(challengeId string, options *protocol.CredentialAssertion) PasskeyChallengeResponse {
+	return PasskeyChallengeResponse{ChallengeId: challengeId, Options: options}
+}
+
+type PasskeyResponse struct {
+	Id         string  `json:"id"`
+	Name       string  `json:"name"`
+	Synced     bool    `json:"synced"`
+	LastUsedAt *string `json:"last_used_at"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+func GeneratePasskeyResponse(passkey models.Passkey) PasskeyResponse {
+	return PasskeyResponse{
+		Id:         passkey.Id,
+		Name:       passkey.Name,
+		Synced:     passkey.BackupState,
+		LastUsedAt: optionalJsonTime(passkey.LastUsedAt),
+		CreatedAt:  helpers.JSONTime{Time: passkey.CreatedAt}.Json(),
+	}
+}
@@ -0,0 +1,29 @@
+package responses
+
+import (
+	"github.com/dudeiebot/ad-ly/helpers"
+)
+
+type SessionResponse struct {
+	Id         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IpAddress  string `json:"ip_address"`
+	Current    bool   `json:"current"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	// opened by support acting as the user
+	Impersonated bool `json:"impersonated"`
+}
+
+func GenerateSessionResponse(session helpers.Session, currentId string) SessionResponse {
+	return SessionResponse{
+		Id:         session.Id,
+		UserAgent:  session.UserAgent,
+		IpAddress:  session.IpAddress,
+		Current:    session.Id == currentId,
+		CreatedAt:  helpers.JSONTime{Time: session.CreatedAt}.Json(),
+		LastSeenAt: helpers.JSONTime{Time: session.LastSeenAt}.Json(),
+
+		Impersonated: session.ActorId != "",
+	}
+}
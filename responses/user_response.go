@@ -6,21 +6,29 @@ import (
 )
 
 type UserResponse struct {
-	Id            string `json:"id"`
-	Name          string `json:"name"`
-	Email         string `json:"email"`
-	EmailVerified bool   `json:"email_verified"`
-	CreatedAt     string `json:"created_at"`
-	UpdatedAt     string `json:"updated_at"`
+	Id               string `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	EmailVerified    bool   `json:"email_verified"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	CreatedAt        string `json:"created_at"`
+	UpdatedAt        string `json:"updated_at"`
 }
 
 func GenerateUserResponse(user models.User) UserResponse {
 	return UserResponse{
-		Id:            user.Id,
-		Name:          user.Name,
-		Email:         user.Email,
-		EmailVerified: user.EmailVerified(),
-		CreatedAt:     helpers.JSONTime{Time: user.CreatedAt}.Json(),
-		UpdatedAt:     helpers.JSONTime{Time: user.UpdatedAt}.Json(),
+		Id:               user.Id,
+		Name:             user.Name,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerified(),
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		CreatedAt:        helpers.JSONTime{Time: user.CreatedAt}.Json(),
+		UpdatedAt:        helpers.JSONTime{Time: user.UpdatedAt}.Json(),
 	}
 }
+
+type VerificationStatusResponse struct {
+	EmailVerified     bool    `json:"email_verified"`
+	EmailVerifiedAt   *string `json:"email_verified_at"`
+	ResendAvailableIn int64   `json:"resend_available_in"`
+}
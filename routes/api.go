@@ -38,11 +38,19 @@ func Routes() *chi.Mux {
 func apiRoutes() *chi.Mux {
 	r := chi.NewRouter()
 
+	// cookies are only accepted cross origin from the configured frontends,
+	// anyone else keeps using bearer tokens
+	allowedOrigins := []string{"https://*"}
+	allowCredentials := len(config.CookieConfig.AllowedOrigins) != 0
+	if allowCredentials {
+		allowedOrigins = config.CookieConfig.AllowedOrigins
+	}
+
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*"},
-		AllowedMethods:   []string{"POST"},
-		AllowedHeaders:   []string{"Accept", "Content-Type", "stripe-signature"},
-		AllowCredentials: false,
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "stripe-signature", helpers.CsrfHeader, helpers.ApiKeyHeader, customMiddleware.OrganizationHeader},
+		AllowCredentials: allowCredentials,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
@@ -51,8 +59,6 @@ func apiRoutes() *chi.Mux {
 
 	r.Use(customMiddleware.AcceptJson)
 
-	r.Use(customMiddleware.ValidateJson)
-
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		_ = json.NewEncoder(w).Encode(helpers.Message("404 Not Found"))
@@ -60,6 +66,7 @@ func apiRoutes() *chi.Mux {
 	})
 
 	r.Group(func(r chi.Router) {
+		r.Use(customMiddleware.ValidateJson)
 		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			_ = json.NewEncoder(w).Encode(helpers.Response("ok", "API IS HEALTHY"))
@@ -69,19 +76,163 @@ func apiRoutes() *chi.Mux {
 	})
 
 	r.Group(func(r chi.Router) {
+		r.With(customMiddleware.ValidateJson).Get("/.well-known/jwks.json", controllers.JsonWebKeys)
+
+		if config.AuthConfig.OidcProviderEnabled() {
+			r.With(customMiddleware.ValidateJson).Get("/.well-known/openid-configuration", controllers.OpenIdConfiguration)
+			r.With(customMiddleware.ValidateForm).Post("/oauth/token", controllers.Token)
+			r.With(customMiddleware.ValidateJson).Get("/oauth/userinfo", controllers.UserInfo)
+		}
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(customMiddleware.ValidateJson)
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/register", controllers.Register)
 			r.Get("/verify-email", controllers.VerifyUser)
+			r.Post("/resend-verification", controllers.ResendVerification)
+			r.Post("/verify-code", controllers.VerifyCode)
 			r.Post("/login", controllers.LoginUser)
+			r.Post("/refresh", controllers.RefreshToken)
+			r.Get("/csrf", controllers.Csrf)
+			r.Post("/mfa/verify", controllers.VerifyMfa)
+			r.Post("/passkeys/login/begin", controllers.BeginPasskeyLogin)
+			r.Post("/passkeys/login/finish", controllers.FinishPasskeyLogin)
+			r.Post("/magic-link", controllers.SendMagicLink)
+			r.Get("/magic-link/consume", controllers.ConsumeMagicLink)
+			r.Get("/unlock", controllers.UnlockAccount)
+			r.Get("/not-me", controllers.DisownLogin)
+			r.Get("/confirm-email-change", controllers.ConfirmEmailChange)
+			r.Get("/oauth/{provider}", controllers.StartOAuth)
+			r.Get("/oauth/{provider}/callback", controllers.OAuthCallback)
 			r.Post("/forgot-password", controllers.ForgotPassword)
 			r.Post("/post-forgot", controllers.PostForgot)
 		})
+
+		r.Get("/invitations", controllers.GetInvitation)
+		r.Post("/invitations/decline", controllers.DeclineInvitation)
 	})
 
 	r.Group(func(r chi.Router) {
+		r.Use(customMiddleware.ValidateJson)
 		r.Use(customMiddleware.AuthenticateUser)
+		r.With(customMiddleware.RejectApiKey).Post("/auth/logout", controllers.Logout)
+		r.With(customMiddleware.RejectApiKey, customMiddleware.RejectImpersonation).Post("/auth/logout-all", controllers.LogoutAll)
+		r.With(customMiddleware.RejectApiKey).Post("/auth/impersonation/stop", controllers.StopImpersonation)
+		if config.AuthConfig.OidcProviderEnabled() {
+			r.With(customMiddleware.RejectApiKey, customMiddleware.RejectImpersonation).Get("/oauth/authorize", controllers.Authorize)
+		}
+		r.Group(func(r chi.Router) {
+			r.Use(customMiddleware.RejectApiKey)
+			r.Get("/auth/passkeys", controllers.GetPasskeys)
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RejectImpersonation)
+				r.Post("/auth/passkeys/register/begin", controllers.BeginPasskeyRegistration)
+				r.Post("/auth/passkeys/register/finish", controllers.FinishPasskeyRegistration)
+				r.Delete("/auth/passkeys/{id}", controllers.DeletePasskey)
+			})
+		})
 		r.Route("/user", func(r chi.Router) {
-			r.Get("/get-user", controllers.GetUser)
+			// the only routes api keys can reach here
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequireScope("profile:read"))
+				r.Get("/get-user", controllers.GetUser)
+				r.Get("/verification-status", controllers.GetVerificationStatus)
+				r.Get("/identities", controllers.GetLinkedIdentities)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RejectApiKey)
+				r.Get("/sessions", controllers.GetSessions)
+				r.Get("/activity", controllers.GetActivity)
+				r.Delete("/sessions/{id}", controllers.DeleteSession)
+				r.Get("/api-keys", controllers.GetApiKeys)
+			})
+
+			// credentials and the account itself stay with the user, even
+			// when support is acting as them
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RejectApiKey)
+				r.Use(customMiddleware.RejectImpersonation)
+				r.Delete("/", controllers.DeleteUser)
+				r.Post("/mfa/setup", controllers.SetupMfa)
+				r.Post("/mfa/confirm", controllers.ConfirmMfa)
+				r.Post("/mfa/disable", controllers.DisableMfa)
+				r.Post("/change-password", controllers.ChangePassword)
+				r.Post("/change-email", controllers.ChangeEmail)
+				r.Post("/export", controllers.ExportUser)
+				r.Post("/identities/{provider}", controllers.LinkOAuth)
+				r.Delete("/identities/{provider}", controllers.UnlinkOAuth)
+				r.Post("/api-keys", controllers.CreateApiKey)
+				r.Patch("/api-keys/{id}", controllers.UpdateApiKey)
+				r.Delete("/api-keys/{id}", controllers.DeleteApiKey)
+			})
+		})
+
+		r.With(customMiddleware.RejectApiKey).Post("/invitations/accept", controllers.AcceptInvitation)
+		r.Route("/orgs", func(r chi.Router) {
+			r.Use(customMiddleware.RejectApiKey)
+			r.Get("/", controllers.GetOrganizations)
+			r.Post("/", controllers.CreateOrganization)
+
+			r.Route("/{org}", func(r chi.Router) {
+				r.Use(customMiddleware.ResolveOrganization)
+				r.Get("/", controllers.GetOrganization)
+				r.Get("/members", controllers.GetMembers)
+				r.Delete("/members/{user}", controllers.RemoveMember)
+
+				r.Group(func(r chi.Router) {
+					r.Use(customMiddleware.RequireOrgRole("admin"))
+					r.Get("/invitations", controllers.GetInvitations)
+					r.Post("/invitations", controllers.InviteMember)
+					r.Delete("/invitations/{id}", controllers.RevokeInvitation)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(customMiddleware.RequireOrgRole("owner"))
+					r.Use(customMiddleware.RejectImpersonation)
+					r.Delete("/", controllers.DeleteOrganization)
+					r.Patch("/members/{user}", controllers.UpdateMember)
+					r.Post("/transfer-ownership", controllers.TransferOwnership)
+				})
+			})
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(customMiddleware.ValidateJson)
+		r.Use(customMiddleware.AuthenticateUser)
+		// an impersonation token never carries admin rights, even if the
+		// user came to hold a role after it was issued
+		r.Use(customMiddleware.RejectImpersonation)
+		r.Route("/admin/users", func(r chi.Router) {
+			r.With(customMiddleware.RequirePermission("users:read")).Get("/", controllers.ListUsers)
+			r.With(customMiddleware.RequirePermission("users:read")).Get("/{id}", controllers.AdminGetUser)
+
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequirePermission("users:write"))
+				r.Patch("/{id}", controllers.AdminUpdateUser)
+				r.Post("/{id}/disable", controllers.DisableUser)
+				r.Post("/{id}/enable", controllers.EnableUser)
+				r.Post("/{id}/verify", controllers.ForceVerifyUser)
+				r.Post("/{id}/password-reset", controllers.ForcePasswordReset)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.RequirePermission("users:impersonate"))
+				r.Get("/{id}/impersonations", controllers.GetImpersonations)
+				r.With(customMiddleware.RejectApiKey).Post("/{id}/impersonate", controllers.StartImpersonation)
+			})
+		})
+
+		r.With(customMiddleware.RequirePermission("audit:read")).Get("/admin/audit-events", controllers.ListAuditEvents)
+
+		r.Route("/admin/oauth-clients", func(r chi.Router) {
+			r.Use(customMiddleware.RequirePermission("oauth_clients:manage"))
+			r.Get("/", controllers.ListOAuthClients)
+			r.Post("/", controllers.CreateOAuthClient)
+			r.Post("/{id}/rotate-secret", controllers.RotateOAuthClientSecret)
+			r.Delete("/{id}", controllers.DeleteOAuthClient)
 		})
 	})
 
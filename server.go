@@ -17,6 +17,8 @@ import (
 	"github.com/hibiken/asynqmon"
 
 	"github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/oauth"
 	"github.com/dudeiebot/ad-ly/queue"
 	"github.com/dudeiebot/ad-ly/routes"
 )
@@ -123,6 +125,13 @@ func initialize() error {
 		return fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	err = helpers.LoadSigningKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	oauth.RegisterConfiguredProviders()
+
 	return nil
 }
 
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+const (
+	defaultUsersPerPage = 20
+	defaultUsersSort    = "-created_at"
+)
+
+// userCursor points at the last row of a page; the next page continues
+// strictly after its (sort value, id) pair.
+type userCursor struct {
+	Value string `json:"v"`
+	Id    string `json:"id"`
+}
+
+func ListUsers(
+	payload request.ListUsers,
+) (response responses.AdminUserListResponse, err error, status int) {
+	var users []models.User
+
+	limit := defaultUsersPerPage
+	if payload.Limit != "" {
+		limit, _ = strconv.Atoi(payload.Limit)
+	}
+
+	sort := payload.Sort
+	if sort == "" {
+		sort = defaultUsersSort
+	}
+	column := strings.TrimPrefix(sort, "-")
+	direction, operator := "ASC", ">"
+	if strings.HasPrefix(sort, "-") {
+		direction, operator = "DESC", "<"
+	}
+
+	query := db.PostDb.Model(&models.User{})
+
+	if payload.Email != "" {
+		query = query.Where("email ILIKE ?", "%"+payload.Email+"%")
+	}
+
+	switch payload.Verified {
+	case "true":
+		query = query.Where("email_verified_at IS NOT NULL")
+	case "false":
+		query = query.Where("email_verified_at IS NULL")
+	}
+
+	if payload.CreatedFrom != "" {
+		from, _ := time.Parse(time.DateOnly, payload.CreatedFrom)
+		query = query.Where("created_at >= ?", from)
+	}
+
+	if payload.CreatedTo != "" {
+		to, _ := time.Parse(time.DateOnly, payload.CreatedTo)
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	if payload.Cursor != "" {
+		value, id, err := decodeUserCursor(payload.Cursor, column)
+		if err != nil {
+			return response, customizedError.ErrInvalidCursor, http.StatusBadRequest
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, operator), value, id)
+	}
+
+	err = query.
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(limit + 1).
+		Find(&users).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if len(users) > limit {
+		users = users[:limit]
+		response.NextCursor = encodeUserCursor(users[limit-1], column)
+	}
+
+	response.Data = make([]responses.AdminUserResponse, 0, len(users))
+	for _, user := range users {
+		response.Data = append(response.Data, responses.GenerateAdminUserResponse(user))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+func AdminGetUser(r *http.Request) (response responses.AdminUserResponse, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	return responses.GenerateAdminUserResponse(user), nil, http.StatusOK
+}
+
+func AdminUpdateUser(
+	r *http.Request,
+	payload request.UpdateUser,
+) (response responses.AdminUserResponse, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	updates := map[string]interface{}{}
+
+	if payload.Name != "" {
+		updates["name"] = payload.Name
+	}
+
+	emailChanged := payload.Email != "" && payload.Email != user.Email
+	if emailChanged {
+		// accounts waiting to be purged still own their email until they are gone
+		var existing models.User
+		_ = db.PostDb.Unscoped().Where("email = ?", payload.Email).Find(&existing)
+		if !existing.Empty() {
+			return response, customizedError.ErrEmaiAlreadyTaken, http.StatusNotAcceptable
+		}
+		// nobody has proven they own the new address yet
+		updates["email"] = payload.Email
+		updates["email_verified_at"] = nil
+	}
+
+	if len(updates) != 0 {
+		if err = db.PostDb.Model(&user).Updates(updates).Error; err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	if emailChanged {
+		user.Email = payload.Email
+		user.EmailVerifiedAt = nil
+
+		if err = helpers.GenerateOtpToken(r.Context(), &user); err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	return responses.GenerateAdminUserResponse(user), nil, http.StatusOK
+}
+
+func DisableUser(r *http.Request) (response responses.AdminUserResponse, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	// stateless verification never loads the user, only the denylist keeps
+	// their tokens out, so the account stays enabled unless it took
+	err = db.PostDb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("disabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return helpers.RevokeUserTokens(r.Context(), user.Id)
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// impersonations they started are their sessions too
+	var impersonations []models.Impersonation
+	err = db.PostDb.Where("actor_id = ? AND ended_at IS NULL", user.Id).Find(&impersonations).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	for _, impersonation := range impersonations {
+		err = helpers.RevokeTokenFamily(r.Context(), impersonation.UserId, impersonation.SessionId)
+		if err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	return responses.GenerateAdminUserResponse(user), nil, http.StatusOK
+}
+
+func EnableUser(r *http.Request) (response responses.AdminUserResponse, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	if err = db.PostDb.Model(&user).Update("disabled_at", nil).Error; err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateAdminUserResponse(user), nil, http.StatusOK
+}
+
+func ForceVerifyUser(r *http.Request) (response responses.AdminUserResponse, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	if !user.EmailVerified() {
+		err = db.PostDb.Model(&user).Update("email_verified_at", time.Now()).Error
+		if err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	return responses.GenerateAdminUserResponse(user), nil, http.StatusOK
+}
+
+// ForcePasswordReset locks the user out of their current password and
+// sessions, leaving the emailed reset link as the only way back in.
+func ForcePasswordReset(r *http.Request) (message map[string]string, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return nil, err, status
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(uuid.New().String()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = db.PostDb.Model(&user).Update("password", string(hashedPassword)).Error
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if err = helpers.RevokeUserTokens(r.Context(), user.Id); err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if err = sendPasswordReset(user); err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Password Reset Email Sent"), nil, http.StatusOK
+}
+
+func findUserByParam(r *http.Request) (user models.User, err error, status int) {
+	err = db.PostDb.Where("id = ?", chi.URLParam(r, "id")).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, customizedError.ErrUserNotFound, http.StatusNotFound
+		}
+		return user, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return user, nil, http.StatusOK
+}
+
+func encodeUserCursor(user models.User, column string) string {
+	cursor := userCursor{Id: user.Id, Value: user.Email}
+	if column == "created_at" {
+		cursor.Value = user.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeUserCursor(encoded, column string) (interface{}, string, error) {
+	var cursor userCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, "", err
+	}
+
+	if column == "created_at" {
+		createdAt, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, "", err
+		}
+		return createdAt, cursor.Id, nil
+	}
+
+	return cursor.Value, cursor.Id, nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+)
+
+// grantRole gives the user a role holding the permissions, creating both
+// as needed.
+func grantRole(t *testing.T, user models.User, name string, permissions ...string) {
+	t.Helper()
+
+	var role models.Role
+	err := db.PostDb.Where(models.Role{Name: name}).Attrs(models.Role{Id: uuid.New().String()}).FirstOrCreate(&role).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range permissions {
+		var permission models.Permission
+		err = db.PostDb.Where(models.Permission{Name: name}).
+			Attrs(models.Permission{Id: uuid.New().String()}).
+			FirstOrCreate(&permission).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.PostDb.Model(&role).Association("Permissions").Append(&permission); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.PostDb.Create(&models.UserRole{UserId: user.Id, RoleId: role.Id, CreatedAt: time.Now()}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servePermission runs the request behind RequirePermission and reports
+// the status it answered with.
+func servePermission(t *testing.T, r *http.Request, permission string) int {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	middlewares.RequirePermission(permission)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRequirePermission(t *testing.T) {
+	setupTestStores(t)
+
+	admin := createTestUser(t, "admin@example.com", true)
+	grantRole(t, admin, "admin", "users:read", "users:write")
+	support := createTestUser(t, "support@example.com", true)
+	grantRole(t, support, "support", "users:read")
+	user := createTestUser(t, "user@example.com", true)
+
+	for _, check := range []struct {
+		user       models.User
+		permission string
+		status     int
+	}{
+		{admin, "users:read", http.StatusNoContent},
+		{admin, "users:write", http.StatusNoContent},
+		{support, "users:read", http.StatusNoContent},
+		{support, "users:write", http.StatusForbidden},
+		{user, "users:read", http.StatusForbidden},
+	} {
+		r := authenticated(t, check.user.Id, httptest.NewRequest(http.MethodGet, "/admin/users", nil))
+		if status := servePermission(t, r, check.permission); status != check.status {
+			t.Fatalf("%s asking for %s got %d", check.user.Email, check.permission, status)
+		}
+	}
+}
+
+// adminRequest is an admin's request about the user with the id.
+func adminRequest(t *testing.T, admin models.User, userId string) *http.Request {
+	t.Helper()
+
+	r := authenticated(t, admin.Id, httptest.NewRequest(http.MethodPost, "/admin/users/"+userId, nil))
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", userId)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+}
+
+// listEmails pages through ListUsers and returns the emails in order.
+func listEmails(t *testing.T, payload request.ListUsers) []string {
+	t.Helper()
+
+	var emails []string
+	for {
+		page, err, status := ListUsers(payload)
+		if err != nil {
+			t.Fatalf("list = %v, %d", err, status)
+		}
+		for _, user := range page.Data {
+			emails = append(emails, user.Email)
+		}
+		if page.NextCursor == "" {
+			return emails
+		}
+		payload.Cursor = page.NextCursor
+	}
+}
+
+func TestListUsersPagesThroughFilters(t *testing.T) {
+	setupTestStores(t)
+
+	for i, email := range []string{"c@example.com", "a@example.com", "e@example.com", "b@example.com", "d@example.com"} {
+		user := createTestUser(t, email, i%2 == 0)
+		db.PostDb.Model(&user).Update("created_at", time.Now().Add(time.Duration(i)*time.Minute))
+	}
+
+	emails := listEmails(t, request.ListUsers{Limit: "2", Sort: "email"})
+	if !slices.Equal(emails, []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"}) {
+		t.Fatalf("by email = %v", emails)
+	}
+
+	emails = listEmails(t, request.ListUsers{Limit: "2"})
+	if !slices.Equal(emails, []string{"d@example.com", "b@example.com", "e@example.com", "a@example.com", "c@example.com"}) {
+		t.Fatalf("newest first = %v", emails)
+	}
+
+	emails = listEmails(t, request.ListUsers{Limit: "1", Sort: "-email", Verified: "false"})
+	if !slices.Equal(emails, []string{"b@example.com", "a@example.com"}) {
+		t.Fatalf("unverified = %v", emails)
+	}
+
+	_, err, status := ListUsers(request.ListUsers{Cursor: "not a cursor"})
+	if !errors.Is(err, customizedError.ErrInvalidCursor) || status != http.StatusBadRequest {
+		t.Fatalf("invalid cursor = %v, %d", err, status)
+	}
+}
+
+func TestDisableUserSignsThemOut(t *testing.T) {
+	setupTestStores(t)
+
+	admin := createTestUser(t, "admin@example.com", true)
+	user := createTestUser(t, "user@example.com", true)
+	token := startTestSession(t, user, homeDevice)
+
+	if _, err, status := DisableUser(adminRequest(t, admin, user.Id)); err != nil {
+		t.Fatalf("disable = %v, %d", err, status)
+	}
+	if signedInAs(token.AccessToken) != "" {
+		t.Fatal("a disabled user's session survived")
+	}
+	_, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, homeDevice)
+	if !errors.Is(err, customizedError.ErrAccountDisabled) || status != http.StatusForbidden {
+		t.Fatalf("disabled login = %v, %d", err, status)
+	}
+
+	if _, err, status = EnableUser(adminRequest(t, admin, user.Id)); err != nil {
+		t.Fatalf("enable = %v, %d", err, status)
+	}
+	passwordLogin(t, user, homeDevice)
+
+	if _, err, status = DisableUser(adminRequest(t, admin, uuid.New().String())); status != http.StatusNotFound {
+		t.Fatalf("disabling nobody = %v, %d", err, status)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+// every key may read its owner's profile; any other scope has to be a
+// permission the owner holds through their roles
+const apiKeyProfileScope = "profile:read"
+
+func GetApiKeys(r *http.Request) (response []responses.ApiKeyResponse, err error, status int) {
+	var apiKeys []models.ApiKey
+	userId := middlewares.GetUserId(r.Context())
+
+	err = db.PostDb.Where("user_id = ?", userId).Order("created_at").Find(&apiKeys).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.ApiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, responses.GenerateApiKeyResponse(apiKey))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+// CreateApiKey answers with the full key; it is not stored and can not be
+// shown again.
+func CreateApiKey(
+	r *http.Request,
+	payload request.CreateApiKey,
+) (response responses.ApiKeyResponse, err error, status int) {
+	if err = validateApiKeyScopes(r, payload.Scopes); err != nil {
+		return response, err, http.StatusUnprocessableEntity
+	}
+
+	var expiresAt *time.Time
+	if payload.ExpiresAt != "" {
+		expiry, _ := time.Parse(time.DateOnly, payload.ExpiresAt)
+		if !expiry.After(time.Now()) {
+			return response, customizedError.ErrInvalidApiKeyExpiry, http.StatusUnprocessableEntity
+		}
+		expiresAt = &expiry
+	}
+
+	key, prefix, secretHash, err := helpers.GenerateApiKey()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	apiKey := models.ApiKey{
+		Id:         uuid.New().String(),
+		UserId:     middlewares.GetUserId(r.Context()),
+		Name:       payload.Name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     strings.Join(payload.Scopes, " "),
+		ExpiresAt:  expiresAt,
+	}
+
+	if err = db.PostDb.Create(&apiKey).Error; err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = responses.GenerateApiKeyResponse(apiKey)
+	response.Key = key
+
+	return response, nil, http.StatusCreated
+}
+
+func UpdateApiKey(
+	r *http.Request,
+	payload request.UpdateApiKey,
+) (response responses.ApiKeyResponse, err error, status int) {
+	apiKey, err, status := findApiKeyByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	updates := map[string]interface{}{}
+
+	if payload.Name != "" {
+		updates["name"] = payload.Name
+	}
+
+	if payload.Scopes != nil {
+		if err = validateApiKeyScopes(r, payload.Scopes); err != nil {
+			return response, err, http.StatusUnprocessableEntity
+		}
+		updates["scopes"] = strings.Join(payload.Scopes, " ")
+	}
+
+	if len(updates) != 0 {
+		if err = db.PostDb.Model(&apiKey).Updates(updates).Error; err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	return responses.GenerateApiKeyResponse(apiKey), nil, http.StatusOK
+}
+
+func DeleteApiKey(r *http.Request) (message map[string]string, err error, status int) {
+	apiKey, err, status := findApiKeyByParam(r)
+	if err != nil {
+		return nil, err, status
+	}
+
+	if err = db.PostDb.Delete(&apiKey).Error; err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Api Key Deleted"), nil, http.StatusOK
+}
+
+func validateApiKeyScopes(r *http.Request, scopes []string) error {
+	for _, scope := range scopes {
+		if scope != apiKeyProfileScope && !middlewares.HasPermission(r.Context(), scope) {
+			return customizedError.ErrInvalidApiKeyScope
+		}
+	}
+	return nil
+}
+
+func findApiKeyByParam(r *http.Request) (apiKey models.ApiKey, err error, status int) {
+	err = db.PostDb.
+		Where("id = ? AND user_id = ?", chi.URLParam(r, "id"), middlewares.GetUserId(r.Context())).
+		First(&apiKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiKey, customizedError.ErrApiKeyNotFound, http.StatusNotFound
+		}
+		return apiKey, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return apiKey, nil, http.StatusOK
+}
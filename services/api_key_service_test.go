@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+)
+
+func createApiKey(t *testing.T, user models.User, scopes ...string) string {
+	t.Helper()
+
+	r := authenticated(t, user.Id, httptest.NewRequest(http.MethodPost, "/user/api-keys", nil))
+	response, err, status := CreateApiKey(r, request.CreateApiKey{Name: "ci", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("create = %v, %d", err, status)
+	}
+	return response.Key
+}
+
+// withApiKey passes r through AuthenticateUser with the key and returns
+// the request a handler behind it would see, or nil when it was refused.
+func withApiKey(key string, r *http.Request) *http.Request {
+	r.Header.Set(helpers.ApiKeyHeader, key)
+
+	var seen *http.Request
+	middlewares.AuthenticateUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	return seen
+}
+
+func TestApiKeysAreLimitedToTheirScopes(t *testing.T) {
+	setupTestStores(t)
+
+	admin := createTestUser(t, "admin@example.com", true)
+	grantRole(t, admin, "admin", "users:read", "users:write")
+	key := createApiKey(t, admin, "users:read")
+
+	r := withApiKey(key, httptest.NewRequest(http.MethodGet, "/admin/users", nil))
+	if r == nil || middlewares.GetUserId(r.Context()) != admin.Id {
+		t.Fatal("expected the key to authenticate its owner")
+	}
+
+	// the owner's roles grant more than the key was given
+	if status := servePermission(t, r, "users:read"); status != http.StatusNoContent {
+		t.Errorf("expected the scoped permission to be allowed, got %d", status)
+	}
+	if status := servePermission(t, r, "users:write"); status != http.StatusForbidden {
+		t.Errorf("expected a permission outside the scopes to be refused, got %d", status)
+	}
+
+	w := httptest.NewRecorder()
+	middlewares.RequireScope("profile:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected the profile to need the profile:read scope, got %d", w.Code)
+	}
+}
+
+func TestApiKeyScopesNeedTheOwnersPermissions(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "user@example.com", true)
+	r := authenticated(t, user.Id, httptest.NewRequest(http.MethodPost, "/user/api-keys", nil))
+
+	if _, err, status := CreateApiKey(r, request.CreateApiKey{Name: "ci", Scopes: []string{"users:write"}}); err != customizedError.ErrInvalidApiKeyScope || status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a key can not grant more than its owner has, got %v (%d)", err, status)
+	}
+
+	if createApiKey(t, user, "profile:read") == "" {
+		t.Fatal("expected every user to be able to create a profile key")
+	}
+}
+
+func TestRefusedApiKeys(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "user@example.com", true)
+	key := createApiKey(t, user, "profile:read")
+	prefix, _, _ := helpers.SplitApiKey(key)
+
+	refused := func(name, key string) {
+		t.Helper()
+		if withApiKey(key, httptest.NewRequest(http.MethodGet, "/user", nil)) != nil {
+			t.Errorf("expected %s to be refused", name)
+		}
+	}
+
+	refused("a wrong secret", prefix+"_wrongsecret")
+	refused("a key without a prefix", "not-a-key")
+
+	expired := time.Now().Add(-time.Minute)
+	if err := db.PostDb.Model(&models.ApiKey{}).Where("prefix = ?", prefix).Update("expires_at", expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	refused("an expired key", key)
+
+	key = createApiKey(t, user, "profile:read")
+	if err := db.PostDb.Model(&user).Update("disabled_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	refused("a disabled user's key", key)
+}
+
+func TestDeletedApiKeysStopWorking(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "user@example.com", true)
+	key := createApiKey(t, user, "profile:read")
+	prefix, _, _ := helpers.SplitApiKey(key)
+
+	var apiKey models.ApiKey
+	if err := db.PostDb.Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		t.Fatal(err)
+	}
+	if apiKey.SecretHash == "" || apiKey.SecretHash == key {
+		t.Fatal("expected only a hash of the secret to be stored")
+	}
+
+	r := authenticated(t, user.Id, httptest.NewRequest(http.MethodDelete, "/user/api-keys/"+apiKey.Id, nil))
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", apiKey.Id)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+	if _, err, status := DeleteApiKey(r); err != nil {
+		t.Fatalf("delete = %v, %d", err, status)
+	}
+
+	if withApiKey(key, httptest.NewRequest(http.MethodGet, "/user", nil)) != nil {
+		t.Fatal("expected the deleted key to be refused")
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/dudeiebot/ad-ly/audit"
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+const defaultAuditEventsPerPage = 50
+
+// recordAudit stamps the event with the client the request came from
+// and queues it for the audit trail.
+func recordAudit(device helpers.Device, event audit.Event) error {
+	event.IpAddress = device.IpAddress
+	event.UserAgent = device.UserAgent
+	event.RequestId = device.RequestId
+
+	return audit.Record(queue.Client, event)
+}
+
+func ListAuditEvents(
+	payload request.ListAuditEvents,
+) (response responses.AuditEventListResponse, err error, status int) {
+	query := db.PostDb.Model(&models.AuditEvent{})
+
+	if payload.ActorId != "" {
+		query = query.Where("actor_id = ?", payload.ActorId)
+	}
+
+	if payload.Action != "" {
+		query = query.Where("action = ?", payload.Action)
+	}
+
+	if payload.TargetType != "" {
+		query = query.Where("target_type = ?", payload.TargetType)
+	}
+
+	if payload.TargetId != "" {
+		query = query.Where("target_id = ?", payload.TargetId)
+	}
+
+	if payload.RequestId != "" {
+		query = query.Where("request_id = ?", payload.RequestId)
+	}
+
+	if payload.From != "" {
+		from, _ := time.Parse(time.DateOnly, payload.From)
+		query = query.Where("created_at >= ?", from)
+	}
+
+	if payload.To != "" {
+		to, _ := time.Parse(time.DateOnly, payload.To)
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	return listAuditEvents(query, payload.Cursor, payload.Limit)
+}
+
+// GetActivity lists what was done by the user and what was done to their
+// account, failed logins included.
+func GetActivity(
+	r *http.Request,
+	payload request.GetActivity,
+) (response responses.AuditEventListResponse, err error, status int) {
+	userId := middlewares.GetUserId(r.Context())
+
+	query := db.PostDb.Model(&models.AuditEvent{}).
+		Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userId, audit.TargetUser, userId)
+
+	return listAuditEvents(query, payload.Cursor, payload.Limit)
+}
+
+// listAuditEvents pages through query newest first.
+func listAuditEvents(
+	query *gorm.DB,
+	cursor, limitParam string,
+) (response responses.AuditEventListResponse, err error, status int) {
+	var events []models.AuditEvent
+
+	limit := defaultAuditEventsPerPage
+	if limitParam != "" {
+		limit, _ = strconv.Atoi(limitParam)
+	}
+
+	if cursor != "" {
+		createdAt, id, err := decodeAuditCursor(cursor)
+		if err != nil {
+			return response, customizedError.ErrInvalidCursor, http.StatusBadRequest
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	err = query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&events).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if len(events) > limit {
+		events = events[:limit]
+		response.NextCursor = encodeAuditCursor(events[limit-1])
+	}
+
+	response.Data = make([]responses.AuditEventResponse, 0, len(events))
+	for _, event := range events {
+		response.Data = append(response.Data, responses.GenerateAuditEventResponse(event))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+func encodeAuditCursor(event models.AuditEvent) string {
+	data, _ := json.Marshal(userCursor{Id: event.Id, Value: event.CreatedAt.Format(time.RFC3339Nano)})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeAuditCursor(encoded string) (time.Time, string, error) {
+	var cursor userCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return time.Time{}, "", err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	return createdAt, cursor.Id, nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+)
+
+// cookieRequest sends the cookies a browser holds for "/" through
+// AuthenticateUser and returns the status it answers with.
+func cookieRequest(method string, cookies []*http.Cookie, csrfHeader string) int {
+	r := httptest.NewRequest(method, "/user", nil)
+	for _, cookie := range cookies {
+		if cookie.Path == "/" {
+			r.AddCookie(cookie)
+		}
+	}
+	if csrfHeader != "" {
+		r.Header.Set(helpers.CsrfHeader, csrfHeader)
+	}
+
+	w := httptest.NewRecorder()
+	middlewares.AuthenticateUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestCookieSessionsNeedTheCsrfToken(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "browser@example.com", true)
+	token := startTestSession(t, user, homeDevice)
+
+	w := httptest.NewRecorder()
+	helpers.SetAuthCookies(w, token.AccessToken, token.RefreshToken)
+	csrf, err := helpers.IssueCsrfToken(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+
+	for _, cookie := range cookies {
+		switch cookie.Name {
+		case helpers.AccessTokenCookie:
+			if !cookie.HttpOnly || !cookie.Secure {
+				t.Error("expected the access token cookie to be HttpOnly and Secure")
+			}
+		case helpers.RefreshTokenCookie:
+			if !cookie.HttpOnly || cookie.Path != "/auth/refresh" {
+				t.Error("expected the refresh token cookie to only go to the refresh endpoint")
+			}
+		case helpers.CsrfCookie:
+			if cookie.HttpOnly {
+				t.Error("expected script to be able to read the csrf cookie")
+			}
+		}
+	}
+
+	for name, test := range map[string]struct {
+		method string
+		header string
+		status int
+	}{
+		"safe method":       {http.MethodGet, "", http.StatusOK},
+		"missing header":    {http.MethodPost, "", http.StatusForbidden},
+		"mismatched header": {http.MethodDelete, "forged", http.StatusForbidden},
+		"echoed header":     {http.MethodPost, csrf, http.StatusOK},
+	} {
+		if status := cookieRequest(test.method, cookies, test.header); status != test.status {
+			t.Errorf("%s: expected %d, got %d", name, test.status, status)
+		}
+	}
+}
+
+func TestBearerTokensNeedNoCsrfToken(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "api@example.com", true)
+	token := startTestSession(t, user, homeDevice)
+
+	// a header can not be attached by another site, so it proves itself
+	r := authenticatedWith(t, token.AccessToken, httptest.NewRequest(http.MethodPost, "/user", nil))
+	if middlewares.GetUserId(r.Context()) != user.Id {
+		t.Fatal("expected the bearer token to authenticate the post")
+	}
+}
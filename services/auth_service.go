@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,10 +13,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/dudeiebot/ad-ly/audit"
 	db "github.com/dudeiebot/ad-ly/config"
 	customizedError "github.com/dudeiebot/ad-ly/errors"
 	"github.com/dudeiebot/ad-ly/helpers"
 	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/middlewares"
 	"github.com/dudeiebot/ad-ly/models"
 	"github.com/dudeiebot/ad-ly/queue"
 	"github.com/dudeiebot/ad-ly/request"
@@ -24,14 +27,20 @@ import (
 
 func RegisterUser(
 	payload request.Register,
+	device helpers.Device,
 ) (response responses.AuthResponse, err error, status int) {
 	var user models.User
-	_ = db.PostDb.Where("email = ?", payload.Email).Find(&user)
+	// accounts waiting to be purged still own their email until they are gone
+	_ = db.PostDb.Unscoped().Where("email = ?", payload.Email).Find(&user)
 
 	if !user.Empty() {
 		return response, customizedError.ErrEmaiAlreadyTaken, http.StatusNotAcceptable
 	}
 
+	if err, status = checkPassword(payload.Password, payload.Name, payload.Email); err != nil {
+		return response, err, status
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return responses.AuthResponse{}, helpers.ServerError(err), http.StatusInternalServerError
@@ -50,23 +59,35 @@ func RegisterUser(
 		return response, helpers.ServerError(err), http.StatusInternalServerError
 	}
 
-	token, err := helpers.GenerateAccessToken(context.Background(), user.Id)
+	err = recordAudit(device, audit.Event{
+		ActorId:    user.Id,
+		Action:     audit.ActionUserRegistered,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+	})
 	if err != nil {
 		return response, helpers.ServerError(err), http.StatusInternalServerError
 	}
 
+	// later sign ins are compared against the device the account was made on
+	if _, err = helpers.RememberDevice(context.Background(), user.Id, device); err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
 	err = helpers.GenerateOtpToken(context.Background(), &user)
 	if err != nil {
 		return response, helpers.ServerError(err), http.StatusInternalServerError
 	}
 
-	return responses.AuthResponse{
-		Token: token,
-		User:  responses.GenerateUserResponse(user),
-	}, nil, http.StatusOK
+	token, err := helpers.GenerateAccessToken(context.Background(), user.Id, device)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateAuthResponse(token, user), nil, http.StatusOK
 }
 
-func VerifyUser(token string) (message map[string]string, err error, status int) {
+func VerifyUser(token string, device helpers.Device) (message map[string]string, err error, status int) {
 	redisKey := "signup_otp_" + token
 	var user models.User
 
@@ -93,54 +114,454 @@ func VerifyUser(token string) (message map[string]string, err error, status int)
 	if err != nil {
 		return nil, helpers.ServerError(err), http.StatusInternalServerError
 	}
+
+	err = recordAudit(device, audit.Event{
+		ActorId:    user.Id,
+		Action:     audit.ActionEmailVerified,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	return helpers.Message("email verified"), nil, http.StatusOK
+}
+
+func ResendVerification(
+	payload request.ResendVerification,
+) (message map[string]string, err error, status int) {
+	var user models.User
+	_ = db.PostDb.Where("email = ?", payload.Email).First(&user).Error
+
+	// unknown and already verified emails get the same answer as a real resend
+	if !user.Empty() && !user.EmailVerified() {
+		if err = helpers.CanSendVerification(context.Background(), user.Id); err != nil {
+			if errors.Is(err, customizedError.ErrCantSendVerificationMail) {
+				return nil, err, http.StatusTooManyRequests
+			}
+			return nil, helpers.ServerError(err), http.StatusInternalServerError
+		}
+
+		err = helpers.GenerateOtpToken(context.Background(), &user)
+		if err != nil {
+			return nil, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+	return helpers.Message("Check Your Email"), nil, http.StatusOK
+}
+
+func VerifyCode(
+	payload request.VerifyCode,
+	device helpers.Device,
+) (message map[string]string, err error, status int) {
+	var user models.User
+	_ = db.PostDb.Where("email = ?", payload.Email).First(&user).Error
+
+	if user.Empty() {
+		return nil, customizedError.ErrInvalidVerificationCode, http.StatusBadRequest
+	}
+
+	if user.EmailVerified() {
+		return nil, customizedError.ErrEmailAlreadyVerified, http.StatusConflict
+	}
+
+	err = helpers.VerifyOtpCode(context.Background(), user.Id, payload.Code)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidVerificationCode) {
+			return nil, err, http.StatusBadRequest
+		}
+		if errors.Is(err, customizedError.ErrTooManyCodeGuesses) {
+			return nil, err, http.StatusTooManyRequests
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = db.PostDb.Model(&user).Update("email_verified_at", time.Now()).Error
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = recordAudit(device, audit.Event{
+		ActorId:    user.Id,
+		Action:     audit.ActionEmailVerified,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
 	return helpers.Message("email verified"), nil, http.StatusOK
 }
 
 func LoginUser(
 	payload request.LoginUser,
+	device helpers.Device,
 ) (response responses.AuthResponse, err error, status int) {
 	var user models.User
-	err = db.PostDb.Where("email = ?", payload.Email).First(&user).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return response, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
-		}
+	ctx := context.Background()
+
+	// deleted accounts are looked up too, signing in during the grace period restores them
+	err = db.PostDb.Unscoped().Where("email = ?", payload.Email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return response, helpers.ServerError(err), http.StatusInternalServerError
 	}
 	fmt.Println(payload.Email)
 
+	if user.DeletedAt.Valid && time.Since(user.DeletedAt.Time) >= db.AuthConfig.DeletionGracePeriod {
+		user = models.User{}
+	}
+
+	if err = helpers.CheckLoginThrottle(ctx, user.Id, device.IpAddress); err != nil {
+		err, status = loginThrottleError(err)
+		return response, err, status
+	}
+
 	if user.Empty() {
+		if err = recordLoginFailure(device, user, payload.Email, "unknown_email"); err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+		if err = helpers.RecordLoginFailure(ctx, nil, device.IpAddress); err != nil {
+			err, status = loginThrottleError(err)
+			return response, err, status
+		}
 		return response, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
+		if err = recordLoginFailure(device, user, payload.Email, "invalid_password"); err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+		if err = helpers.RecordLoginFailure(ctx, &user, device.IpAddress); err != nil {
+			err, status = loginThrottleError(err)
+			return response, err, status
+		}
 		return response, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
 	}
 
+	// failures are only forgiven once every factor has been passed, an
+	// open mfa challenge leaves them counting, see VerifyMfa. other sign
+	// in methods never forgive them, they would bypass the lockout
+	if !user.TwoFactorEnabled() {
+		if err = helpers.ClearLoginFailures(ctx, user.Id); err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	return signIn(user, device, "password", user.TwoFactorEnabled())
+}
+
+// signIn finishes every login the same way whichever first factor the
+// user passed, a password, passkey, magic link or oauth provider: the email
+// has to be verified, the device is remembered, the user alerted when it is
+// new and the login audited. method names the factor for the audit trail.
+// challengeMfa is false when the factor already counts as two, like a
+// passkey with user verification.
+func signIn(
+	user models.User,
+	device helpers.Device,
+	method string,
+	challengeMfa bool,
+) (response responses.AuthResponse, err error, status int) {
+	ctx := context.Background()
+
 	if !user.EmailVerified() {
-		if err = helpers.CanSendVerification(context.Background(), user.Id); err != nil {
+		if err = helpers.CanSendVerification(ctx, user.Id); err != nil {
 			return response, helpers.ServerError(err), http.StatusUnauthorized
 		}
-		err = helpers.GenerateOtpToken(context.Background(), &user)
+		err = helpers.GenerateOtpToken(ctx, &user)
 		if err != nil {
 			return response, helpers.ServerError(err), http.StatusInternalServerError
 		}
 		return response, customizedError.ErrEmailNotVerified, http.StatusUnauthorized
 	}
 
-	token, err := helpers.GenerateAccessToken(context.Background(), user.Id)
+	if user.Disabled() {
+		return response, customizedError.ErrAccountDisabled, http.StatusForbidden
+	}
+
+	// the first factor was right, so a new device is worth telling the
+	// user about even while the mfa challenge is still open
+	newDevice, err := helpers.RememberDevice(ctx, user.Id, device)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if newDevice {
+		if err = helpers.SendLoginAlert(ctx, user, device); err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	err = recordAudit(device, audit.Event{
+		ActorId:    user.Id,
+		Action:     audit.ActionLoginSucceeded,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+		Metadata: map[string]string{
+			"method":       method,
+			"mfa_required": strconv.FormatBool(challengeMfa),
+			"new_device":   strconv.FormatBool(newDevice),
+		},
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// tokens go out last so a failure above leaves no live session behind
+	return startSession(user, device, challengeMfa)
+}
+
+// recordLoginFailure audits a rejected password login. user is empty when
+// no account has the email, which is kept so guessing can be spotted.
+func recordLoginFailure(device helpers.Device, user models.User, email, reason string) error {
+	event := audit.Event{
+		Action:   audit.ActionLoginFailed,
+		Metadata: map[string]string{"email": email, "reason": reason},
+	}
+	if !user.Empty() {
+		event.TargetType = audit.TargetUser
+		event.TargetId = user.Id
+	}
+
+	return recordAudit(device, event)
+}
+
+func loginThrottleError(err error) (error, int) {
+	switch {
+	case errors.Is(err, customizedError.ErrAccountLocked):
+		return err, http.StatusLocked
+	case errors.Is(err, customizedError.ErrTooManyLoginAttempts):
+		return err, http.StatusTooManyRequests
+	}
+	return helpers.ServerError(err), http.StatusInternalServerError
+}
+
+// restoreDeletedUser undoes a deletion still inside its grace period. It
+// is only called once tokens are about to be issued, so the password alone
+// never restores an account protected by mfa.
+func restoreDeletedUser(user *models.User) error {
+	if !user.DeletedAt.Valid {
+		return nil
+	}
+
+	err := db.PostDb.Unscoped().Model(&models.User{}).Where("id = ?", user.Id).
+		Update("deleted_at", nil).Error
+	if err != nil {
+		return err
+	}
+
+	user.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+// checkPassword applies the password policy to a password being set,
+// handing back PasswordPolicyError as is for the controller to report.
+func checkPassword(password, name, email string) (error, int) {
+	err := helpers.CheckPassword(password, name, email)
+	if err == nil {
+		return nil, 0
+	}
+
+	var policyErr helpers.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return err, http.StatusUnprocessableEntity
+	}
+	return helpers.ServerError(err), http.StatusInternalServerError
+}
+
+// startSession hands out tokens, or an mfa challenge when challengeMfa.
+func startSession(
+	user models.User,
+	device helpers.Device,
+	challengeMfa bool,
+) (response responses.AuthResponse, err error, status int) {
+	if challengeMfa {
+		challenge, err := helpers.GenerateMfaChallenge(context.Background(), user.Id)
+		if err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+		return responses.GenerateMfaChallengeResponse(challenge), nil, http.StatusOK
+	}
+
+	if err = restoreDeletedUser(&user); err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	token, err := helpers.GenerateAccessToken(context.Background(), user.Id, device)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateAuthResponse(token, user), nil, http.StatusOK
+}
+
+func SendMagicLink(
+	payload request.MagicLink,
+) (message map[string]string, err error, status int) {
+	var user models.User
+	_ = db.PostDb.Where("email = ?", payload.Email).First(&user).Error
+
+	if !user.Empty() {
+		if err = helpers.CanSendMagicLink(context.Background(), user.Id); err != nil {
+			if errors.Is(err, customizedError.ErrCantSendMagicLink) {
+				return nil, err, http.StatusTooManyRequests
+			}
+			return nil, helpers.ServerError(err), http.StatusInternalServerError
+		}
+
+		err = helpers.GenerateMagicLink(context.Background(), &user)
+		if err != nil {
+			return nil, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+	return helpers.Message("Check Your Email"), nil, http.StatusOK
+}
+
+func ConsumeMagicLink(
+	token string,
+	device helpers.Device,
+) (response responses.AuthResponse, err error, status int) {
+	var user models.User
+	ctx := context.Background()
+
+	userId, err := helpers.MagicLinkUser(ctx, token)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidMagicLink) {
+			return response, err, http.StatusUnauthorized
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// a locked account stays locked, the link is kept for once it is unlocked
+	locked, err := helpers.LoginLocked(ctx, userId)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if locked {
+		return response, customizedError.ErrAccountLocked, http.StatusLocked
+	}
+
+	userId, err = helpers.ConsumeMagicLink(ctx, token)
 	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidMagicLink) {
+			return response, err, http.StatusUnauthorized
+		}
 		return response, helpers.ServerError(err), http.StatusInternalServerError
 	}
 
-	return responses.AuthResponse{
-		Token: token,
-		User:  responses.GenerateUserResponse(user),
-	}, nil, http.StatusOK
+	err = db.PostDb.Where("id = ?", userId).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response, customizedError.ErrInvalidMagicLink, http.StatusUnauthorized
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// the link was delivered to the inbox, which proves ownership of it
+	if !user.EmailVerified() {
+		now := time.Now()
+		err = db.PostDb.Model(&user).Update("email_verified_at", now).Error
+		if err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+		user.EmailVerifiedAt = &now
+	}
+
+	return signIn(user, device, "magic_link", user.TwoFactorEnabled())
+}
+
+func UnlockAccount(token string) (message map[string]string, err error, status int) {
+	err = helpers.UnlockAccount(context.Background(), token)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidUnlockToken) {
+			return nil, err, http.StatusNotAcceptable
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Account Unlocked"), nil, http.StatusOK
+}
+
+// DisownLogin answers the "this wasn't me" link of a sign in alert: every
+// session of the user is revoked and a password reset is mailed, the same
+// one ForgotPassword sends.
+func DisownLogin(token string, device helpers.Device) (message map[string]string, err error, status int) {
+	ctx := context.Background()
+
+	userId, err := helpers.ConsumeLoginAlert(ctx, token)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidLoginAlert) {
+			return nil, err, http.StatusNotAcceptable
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	var user models.User
+	err = db.PostDb.Where("id = ?", userId).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, customizedError.ErrInvalidLoginAlert, http.StatusNotAcceptable
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if err = helpers.RevokeUserTokens(ctx, user.Id); err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// whichever device was disowned has to raise an alert again
+	if err = helpers.ForgetDevices(ctx, user.Id); err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if err = sendPasswordReset(user); err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = recordAudit(device, audit.Event{
+		ActorId:    user.Id,
+		Action:     audit.ActionLoginDisowned,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Signed Out Everywhere, Check Your Email To Reset Your Password"), nil, http.StatusOK
+}
+
+func RefreshToken(
+	payload request.RefreshToken,
+) (response responses.AuthResponse, err error, status int) {
+	var user models.User
+
+	token, userId, err := helpers.RotateRefreshToken(context.Background(), payload.RefreshToken)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidRefreshToken) ||
+			errors.Is(err, customizedError.ErrRefreshTokenReused) {
+			return response, err, http.StatusUnauthorized
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = db.PostDb.Where("id = ?", userId).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response, customizedError.ErrInvalidRefreshToken, http.StatusUnauthorized
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if user.Disabled() {
+		return response, customizedError.ErrAccountDisabled, http.StatusForbidden
+	}
+
+	return responses.GenerateAuthResponse(token, user), nil, http.StatusOK
 }
 
 func ForgotPassword(
 	payload request.ForgotPassword,
+	device helpers.Device,
 ) (message map[string]string, err error, status int) {
 	var user models.User
 	_ = db.PostDb.Where("email = ?", payload.Email).First(&user).Error
@@ -149,22 +570,14 @@ func ForgotPassword(
 	}
 
 	if !user.Empty() {
-		token := uuid.New().String()
-		err = db.Redis.Set(context.Background(), "forgot_password_"+token, user.Id, time.Hour*1).
-			Err()
-		if err != nil {
+		if err = sendPasswordReset(user); err != nil {
 			return nil, helpers.ServerError(err), http.StatusInternalServerError
 		}
-		apiHost := db.GetApiHost()
 
-		err = mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
-			TemplateName: "forget_password",
-			To:           user.Email,
-			Subject:      "Reset Your Password",
-			Data: map[string]interface{}{
-				"password_reset": fmt.Sprintf("%s/auth/password_reset?token=%s", apiHost, token),
-				"Name":           user.Name,
-			},
+		err = recordAudit(device, audit.Event{
+			Action:     audit.ActionPasswordResetRequested,
+			TargetType: audit.TargetUser,
+			TargetId:   user.Id,
 		})
 		if err != nil {
 			return nil, helpers.ServerError(err), http.StatusInternalServerError
@@ -173,7 +586,30 @@ func ForgotPassword(
 	return helpers.Message("Check Your Email"), nil, http.StatusOK
 }
 
-func PostForgot(payload request.PostForgot) (message map[string]string, err error, status int) {
+func sendPasswordReset(user models.User) error {
+	token := uuid.New().String()
+	err := db.Redis.Set(context.Background(), "forgot_password_"+token, user.Id, time.Hour*1).
+		Err()
+	if err != nil {
+		return err
+	}
+	apiHost := db.GetApiHost()
+
+	return mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "forget_password",
+		To:           user.Email,
+		Subject:      "Reset Your Password",
+		Data: map[string]interface{}{
+			"password_reset": fmt.Sprintf("%s/auth/password_reset?token=%s", apiHost, token),
+			"Name":           user.Name,
+		},
+	})
+}
+
+func PostForgot(
+	payload request.PostForgot,
+	device helpers.Device,
+) (message map[string]string, err error, status int) {
 	redisKey := "forgot_password_" + payload.Token
 	var user models.User
 
@@ -189,6 +625,11 @@ func PostForgot(payload request.PostForgot) (message map[string]string, err erro
 	if err != nil {
 		return nil, helpers.ServerError(err), http.StatusInternalServerError
 	}
+
+	if err, status = checkPassword(payload.Password, user.Name, user.Email); err != nil {
+		return nil, err, status
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, helpers.ServerError(err), http.StatusInternalServerError
@@ -199,10 +640,48 @@ func PostForgot(payload request.PostForgot) (message map[string]string, err erro
 		return nil, helpers.ServerError(err), http.StatusInternalServerError
 	}
 
+	// whoever knew the old password may still hold a session
+	if err = helpers.RevokeUserTokens(context.Background(), user.Id); err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
 	err = db.Redis.Del(context.Background(), redisKey).Err()
 	if err != nil {
 		return nil, helpers.ServerError(err), http.StatusInternalServerError
 	}
 
+	err = recordAudit(device, audit.Event{
+		ActorId:    user.Id,
+		Action:     audit.ActionPasswordResetCompleted,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
 	return helpers.Message("Password Reset Completed"), nil, http.StatusOK
 }
+
+func Logout(r *http.Request) (message map[string]string, err error, status int) {
+	userId := middlewares.GetUserId(r.Context())
+	sessionId := middlewares.GetSessionId(r.Context())
+
+	err = helpers.RevokeTokenFamily(r.Context(), userId, sessionId)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Logged Out"), nil, http.StatusOK
+}
+
+func LogoutAll(r *http.Request) (message map[string]string, err error, status int) {
+	userId := middlewares.GetUserId(r.Context())
+
+	err = helpers.RevokeUserTokens(r.Context(), userId)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Logged Out Of All Sessions"), nil, http.StatusOK
+}
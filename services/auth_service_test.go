@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dudeiebot/ad-ly/audit"
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+	"github.com/dudeiebot/ad-ly/request"
+)
+
+var (
+	homeDevice    = helpers.Device{IpAddress: "203.0.113.1", UserAgent: "home"}
+	unknownDevice = helpers.Device{IpAddress: "198.51.100.7", UserAgent: "unknown"}
+)
+
+func passwordLogin(t *testing.T, user models.User, device helpers.Device) {
+	t.Helper()
+
+	_, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, device)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("login = %v, %d", err, status)
+	}
+}
+
+// loginAlerts returns the tokens of the sign in alerts sent so far.
+func loginAlerts(t *testing.T) []string {
+	t.Helper()
+
+	keys, err := db.Redis.Keys(context.Background(), "login_alert_*").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tokens = append(tokens, strings.TrimPrefix(key, "login_alert_"))
+	}
+	return tokens
+}
+
+func TestLoginAlertsOnlyForNewDevices(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "alerts@example.com", true)
+	// what registration does
+	if _, err := helpers.RememberDevice(context.Background(), user.Id, homeDevice); err != nil {
+		t.Fatal(err)
+	}
+
+	passwordLogin(t, user, homeDevice)
+	if alerts := loginAlerts(t); len(alerts) != 0 {
+		t.Fatalf("%d alerts for the registration device", len(alerts))
+	}
+
+	passwordLogin(t, user, unknownDevice)
+	if alerts := loginAlerts(t); len(alerts) != 1 {
+		t.Fatalf("%d alerts for a new device", len(alerts))
+	}
+
+	passwordLogin(t, user, unknownDevice)
+	if alerts := loginAlerts(t); len(alerts) != 1 {
+		t.Fatalf("%d alerts after signing in from the device again", len(alerts))
+	}
+}
+
+func TestLoginAlertAfterDisowningLogin(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "disown@example.com", true)
+	if _, err := helpers.RememberDevice(context.Background(), user.Id, homeDevice); err != nil {
+		t.Fatal(err)
+	}
+
+	passwordLogin(t, user, unknownDevice)
+	alerts := loginAlerts(t)
+	if len(alerts) != 1 {
+		t.Fatalf("%d alerts for a new device", len(alerts))
+	}
+
+	if _, err, status := DisownLogin(alerts[0], homeDevice); err != nil {
+		t.Fatalf("disown = %v, %d", err, status)
+	}
+
+	// the disowned device is most likely the attacker's, it has to alert again
+	passwordLogin(t, user, unknownDevice)
+	if alerts = loginAlerts(t); len(alerts) != 1 {
+		t.Fatalf("%d alerts after disowning the login", len(alerts))
+	}
+}
+
+func TestLoginAlertWithoutKnownDevices(t *testing.T) {
+	mr := setupTestStores(t)
+
+	// accounts from before alerts have no known devices
+	user := createTestUser(t, "legacy@example.com", true)
+
+	passwordLogin(t, user, homeDevice)
+	if alerts := loginAlerts(t); len(alerts) != 1 {
+		t.Fatalf("%d alerts for an account without known devices", len(alerts))
+	}
+
+	// the alert expires well before the known devices do
+	mr.FastForward(helpers.KnownDeviceExpiry)
+
+	passwordLogin(t, user, homeDevice)
+	if alerts := loginAlerts(t); len(alerts) != 1 {
+		t.Fatalf("%d alerts once the known devices expired", len(alerts))
+	}
+}
+
+func TestMagicLinkLoginAlertsAndAudits(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "magic@example.com", true)
+	if _, err := helpers.RememberDevice(context.Background(), user.Id, homeDevice); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := helpers.GenerateMagicLink(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := db.Redis.Keys(context.Background(), "magic_link_*").Result()
+	if len(keys) != 1 {
+		t.Fatalf("%d magic links", len(keys))
+	}
+
+	_, err, status := ConsumeMagicLink(strings.TrimPrefix(keys[0], "magic_link_"), unknownDevice)
+	if err != nil {
+		t.Fatalf("magic link login = %v, %d", err, status)
+	}
+
+	if alerts := loginAlerts(t); len(alerts) != 1 {
+		t.Fatalf("%d alerts for a magic link login from a new device", len(alerts))
+	}
+
+	events := auditEvents(t, audit.ActionLoginSucceeded)
+	if len(events) != 1 || events[0].Metadata["method"] != "magic_link" || events[0].Metadata["new_device"] != "true" {
+		t.Fatalf("audited %+v", events)
+	}
+}
+
+func TestFailedLoginAuditLeavesNoSession(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "unaudited@example.com", true)
+	if _, err := helpers.RememberDevice(context.Background(), user.Id, homeDevice); err != nil {
+		t.Fatal(err)
+	}
+
+	// the audit event can no longer be queued
+	_ = queue.Client.Close()
+
+	_, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, homeDevice)
+	if err == nil || status != http.StatusInternalServerError {
+		t.Fatalf("login = %v, %d", err, status)
+	}
+
+	sessions, err := helpers.ListUserSessions(context.Background(), user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("%d sessions left by a login that failed", len(sessions))
+	}
+}
+
+func TestMagicLinkRespectsLockout(t *testing.T) {
+	setupTestStores(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, "locked@example.com", true)
+	for range db.AuthConfig.LoginMaxAttempts {
+		_ = helpers.RecordLoginFailure(ctx, &user, homeDevice.IpAddress)
+	}
+
+	if err := helpers.GenerateMagicLink(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := db.Redis.Keys(ctx, "magic_link_*").Result()
+	if len(keys) != 1 {
+		t.Fatalf("%d magic links", len(keys))
+	}
+	token := strings.TrimPrefix(keys[0], "magic_link_")
+
+	_, err, status := ConsumeMagicLink(token, homeDevice)
+	if status != http.StatusLocked {
+		t.Fatalf("magic link on a locked account = %v, %d", err, status)
+	}
+	if locked, _ := helpers.LoginLocked(ctx, user.Id); !locked {
+		t.Fatal("a magic link lifted the lockout")
+	}
+
+	// the link outlives the lockout, and signing in with it still forgives nothing
+	if err = helpers.ClearLoginFailures(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	_ = helpers.RecordLoginFailure(ctx, &user, homeDevice.IpAddress)
+
+	if _, err, status = ConsumeMagicLink(token, homeDevice); err != nil {
+		t.Fatalf("magic link once unlocked = %v, %d", err, status)
+	}
+	if failures, _ := db.Redis.Get(ctx, "login_failures_user_"+user.Id).Int(); failures != 1 {
+		t.Fatalf("%d failures left after a magic link login", failures)
+	}
+}
+
+func TestPasswordResetSignsOutEverywhere(t *testing.T) {
+	setupTestStores(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, "reset@example.com", true)
+	token, err := helpers.GenerateAccessToken(ctx, user.Id, homeDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Redis.Set(ctx, "forgot_password_reset-token", user.Id, time.Hour).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err, status := PostForgot(request.PostForgot{Token: "reset-token", Password: "a brand new passphrase"}, unknownDevice)
+	if err != nil {
+		t.Fatalf("reset = %v, %d", err, status)
+	}
+
+	if _, _, err = helpers.RotateRefreshToken(ctx, token.RefreshToken); err == nil {
+		t.Fatal("a refresh token from before the reset still works")
+	}
+	if sessions, _ := helpers.ListUserSessions(ctx, user.Id); len(sessions) != 0 {
+		t.Fatalf("%d sessions left after the reset", len(sessions))
+	}
+}
+
+func TestVerifyCodeIsAudited(t *testing.T) {
+	setupTestStores(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, "code@example.com", false)
+	if err := helpers.GenerateOtpToken(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	code, err := db.Redis.HGet(ctx, "signup_code_"+user.Id, "code").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err, status := VerifyCode(request.VerifyCode{Email: user.Email, Code: code}, homeDevice); err != nil {
+		t.Fatalf("verify = %v, %d", err, status)
+	}
+
+	events := auditEvents(t, audit.ActionEmailVerified)
+	if len(events) != 1 || events[0].TargetId != user.Id || events[0].IpAddress != homeDevice.IpAddress {
+		t.Fatalf("audited %+v", events)
+	}
+}
+
+// signedInAs returns the user a request carrying the access token is
+// signed in as, "" when the token is no longer accepted.
+func signedInAs(accessToken string) string {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	return helpers.RequestUserId(r)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "refresh@example.com", true)
+	first, err := helpers.GenerateAccessToken(context.Background(), user.Id, homeDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err, status := RefreshToken(request.RefreshToken{RefreshToken: first.RefreshToken})
+	if err != nil {
+		t.Fatalf("refresh = %v, %d", err, status)
+	}
+	if second.RefreshToken == first.RefreshToken || signedInAs(second.Token) != user.Id {
+		t.Fatal("refreshing did not hand out a new working token pair")
+	}
+
+	third, err, status := RefreshToken(request.RefreshToken{RefreshToken: second.RefreshToken})
+	if err != nil {
+		t.Fatalf("refreshing the rotated token = %v, %d", err, status)
+	}
+
+	// replaying a used refresh token looks like theft, the whole family goes
+	_, err, status = RefreshToken(request.RefreshToken{RefreshToken: first.RefreshToken})
+	if !errors.Is(err, customizedError.ErrRefreshTokenReused) || status != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token = %v, %d", err, status)
+	}
+	if _, err, _ = RefreshToken(request.RefreshToken{RefreshToken: third.RefreshToken}); err == nil {
+		t.Fatal("the latest refresh token outlived reuse of an older one")
+	}
+	if signedInAs(third.Token) != "" {
+		t.Fatal("the latest access token outlived reuse of an older refresh token")
+	}
+
+	_, err, status = RefreshToken(request.RefreshToken{RefreshToken: "not a token"})
+	if !errors.Is(err, customizedError.ErrInvalidRefreshToken) || status != http.StatusUnauthorized {
+		t.Fatalf("invalid refresh token = %v, %d", err, status)
+	}
+}
+
+func startTestSession(t *testing.T, user models.User, device helpers.Device) helpers.AuthToken {
+	t.Helper()
+
+	token, err := helpers.GenerateAccessToken(context.Background(), user.Id, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestLogoutEndsOnlyTheCurrentSession(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "logout@example.com", true)
+	phone := startTestSession(t, user, homeDevice)
+	laptop := startTestSession(t, user, unknownDevice)
+
+	r := authenticatedWith(t, phone.AccessToken, httptest.NewRequest(http.MethodPost, "/auth/logout", nil))
+	if _, err, status := Logout(r); err != nil {
+		t.Fatalf("logout = %v, %d", err, status)
+	}
+
+	if signedInAs(phone.AccessToken) != "" {
+		t.Fatal("the access token survived logging out")
+	}
+	if _, _, err := helpers.RotateRefreshToken(context.Background(), phone.RefreshToken); err == nil {
+		t.Fatal("the refresh token survived logging out")
+	}
+	if signedInAs(laptop.AccessToken) != user.Id {
+		t.Fatal("logging out ended another session")
+	}
+}
+
+func TestLogoutAllEndsEverySession(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "everywhere@example.com", true)
+	other := createTestUser(t, "bystander@example.com", true)
+	phone := startTestSession(t, user, homeDevice)
+	laptop := startTestSession(t, user, unknownDevice)
+	bystander := startTestSession(t, other, homeDevice)
+
+	r := authenticatedWith(t, phone.AccessToken, httptest.NewRequest(http.MethodPost, "/auth/logout-all", nil))
+	if _, err, status := LogoutAll(r); err != nil {
+		t.Fatalf("logout all = %v, %d", err, status)
+	}
+
+	for _, token := range []helpers.AuthToken{phone, laptop} {
+		if signedInAs(token.AccessToken) != "" {
+			t.Fatal("a session survived logging out everywhere")
+		}
+	}
+	if sessions, _ := helpers.ListUserSessions(context.Background(), user.Id); len(sessions) != 0 {
+		t.Fatalf("%d sessions still listed", len(sessions))
+	}
+	if signedInAs(bystander.AccessToken) != other.Id {
+		t.Fatal("logging out everywhere ended another user's session")
+	}
+}
+
+func wrongPasswordLogin(user models.User, device helpers.Device) (error, int) {
+	_, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: "wrong password"}, device)
+	return err, status
+}
+
+func TestLoginBackoffAndLockout(t *testing.T) {
+	mr := setupTestStores(t)
+
+	user := createTestUser(t, "lockout@example.com", true)
+
+	for attempt := 1; attempt < db.AuthConfig.LoginMaxAttempts; attempt++ {
+		if err, status := wrongPasswordLogin(user, homeDevice); status != http.StatusUnauthorized {
+			t.Fatalf("failure %d = %v, %d", attempt, err, status)
+		}
+		// each failure makes the next attempt wait, however right it is
+		_, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, homeDevice)
+		if !errors.Is(err, customizedError.ErrTooManyLoginAttempts) || status != http.StatusTooManyRequests {
+			t.Fatalf("attempt during back-off %d = %v, %d", attempt, err, status)
+		}
+		mr.FastForward(time.Minute)
+	}
+
+	err, status := wrongPasswordLogin(user, homeDevice)
+	if !errors.Is(err, customizedError.ErrAccountLocked) || status != http.StatusLocked {
+		t.Fatalf("last failure = %v, %d", err, status)
+	}
+	mr.FastForward(time.Minute)
+	_, err, status = LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, homeDevice)
+	if status != http.StatusLocked {
+		t.Fatalf("right password while locked = %v, %d", err, status)
+	}
+
+	// the emailed link lifts the lock
+	keys, _ := db.Redis.Keys(context.Background(), "login_unlock_*").Result()
+	if len(keys) != 1 {
+		t.Fatalf("%d unlock links", len(keys))
+	}
+	if _, err, status = UnlockAccount(strings.TrimPrefix(keys[0], "login_unlock_")); err != nil {
+		t.Fatalf("unlock = %v, %d", err, status)
+	}
+	passwordLogin(t, user, homeDevice)
+}
+
+func TestLoginBackoffPerIp(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "ip@example.com", true)
+
+	_, err, status := LoginUser(request.LoginUser{Email: "nobody@example.com", Password: testPassword}, unknownDevice)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unknown email = %v, %d", err, status)
+	}
+
+	// guessing at other accounts slows the ip down for every account
+	_, err, status = LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, unknownDevice)
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("same ip = %v, %d", err, status)
+	}
+	passwordLogin(t, user, homeDevice)
+}
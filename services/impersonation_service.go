@@ -0,0 +1,110 @@
+package services
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+// StartImpersonation mints tokens for the user on behalf of the calling
+// admin and records who did it, from where and why. The tokens are
+// returned rather than set as cookies, so the admin's own session stays
+// as it was.
+func StartImpersonation(
+	r *http.Request,
+	payload request.StartImpersonation,
+) (response responses.AuthResponse, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	actorId := middlewares.GetUserId(r.Context())
+	if user.Id == actorId || user.Disabled() {
+		return response, customizedError.ErrCantImpersonate, http.StatusForbidden
+	}
+
+	// admins can not borrow each other's privileges, whichever they hold
+	var privileged int64
+	err = db.PostDb.Model(&models.UserRole{}).
+		Where("user_id = ?", user.Id).
+		Count(&privileged).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if privileged != 0 {
+		return response, customizedError.ErrCantImpersonate, http.StatusForbidden
+	}
+
+	device := helpers.DeviceFromRequest(r)
+
+	token, err := helpers.GenerateImpersonationToken(r.Context(), user.Id, actorId, device)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	impersonation := models.Impersonation{
+		Id:        uuid.New().String(),
+		ActorId:   actorId,
+		UserId:    user.Id,
+		SessionId: token.SessionId,
+		Reason:    payload.Reason,
+		IpAddress: device.IpAddress,
+		UserAgent: device.UserAgent,
+		StartedAt: time.Now(),
+		ExpiresAt: time.Now().Add(helpers.RefreshTokenExpiry),
+	}
+
+	if err = db.PostDb.Create(&impersonation).Error; err != nil {
+		_ = helpers.RevokeTokenFamily(r.Context(), user.Id, token.SessionId)
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateAuthResponse(token, user), nil, http.StatusCreated
+}
+
+// StopImpersonation revokes the tokens of the impersonation the request is
+// made with, which ends it.
+func StopImpersonation(r *http.Request) (message map[string]string, err error, status int) {
+	if !middlewares.IsImpersonating(r.Context()) {
+		return nil, customizedError.ErrNotImpersonating, http.StatusBadRequest
+	}
+
+	sessionId := middlewares.GetSessionId(r.Context())
+
+	err = helpers.RevokeTokenFamily(r.Context(), middlewares.GetUserId(r.Context()), sessionId)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Impersonation Stopped"), nil, http.StatusOK
+}
+
+func GetImpersonations(r *http.Request) (response []responses.ImpersonationResponse, err error, status int) {
+	user, err, status := findUserByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	var impersonations []models.Impersonation
+	err = db.PostDb.Where("user_id = ?", user.Id).Order("started_at DESC").Find(&impersonations).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.ImpersonationResponse, 0, len(impersonations))
+	for _, impersonation := range impersonations {
+		response = append(response, responses.GenerateImpersonationResponse(impersonation))
+	}
+
+	return response, nil, http.StatusOK
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+// impersonate starts an impersonation of the user the way
+// StartImpersonation does, without the admin checks in front of it.
+func impersonate(t *testing.T, admin, user models.User) (helpers.AuthToken, models.Impersonation) {
+	t.Helper()
+
+	token, err := helpers.GenerateImpersonationToken(context.Background(), user.Id, admin.Id, homeDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	impersonation := models.Impersonation{
+		Id:        uuid.New().String(),
+		ActorId:   admin.Id,
+		UserId:    user.Id,
+		SessionId: token.SessionId,
+		StartedAt: time.Now(),
+		ExpiresAt: time.Now().Add(helpers.RefreshTokenExpiry),
+	}
+	if err = db.PostDb.Create(&impersonation).Error; err != nil {
+		t.Fatal(err)
+	}
+	return token, impersonation
+}
+
+func reloadImpersonation(t *testing.T, impersonation models.Impersonation) models.Impersonation {
+	t.Helper()
+
+	var reloaded models.Impersonation
+	if err := db.PostDb.Where("id = ?", impersonation.Id).First(&reloaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	return reloaded
+}
+
+func TestImpersonationEndsWhenItsSessionIsRevoked(t *testing.T) {
+	setupTestStores(t)
+	ctx := context.Background()
+
+	admin := createTestUser(t, "admin@example.com", true)
+	user := createTestUser(t, "user@example.com", true)
+
+	// the user signing out everywhere
+	_, impersonation := impersonate(t, admin, user)
+	if err := helpers.RevokeUserTokens(ctx, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	if reloadImpersonation(t, impersonation).End() == nil {
+		t.Fatal("impersonation still running after its session was revoked")
+	}
+
+	// a refresh token replayed after it was rotated
+	token, impersonation := impersonate(t, admin, user)
+	if _, _, err := helpers.RotateRefreshToken(ctx, token.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if reloadImpersonation(t, impersonation).End() != nil {
+		t.Fatal("impersonation ended by a refresh")
+	}
+	if _, _, err := helpers.RotateRefreshToken(ctx, token.RefreshToken); err == nil {
+		t.Fatal("a reused refresh token was accepted")
+	}
+	if reloadImpersonation(t, impersonation).End() == nil {
+		t.Fatal("impersonation still running after refresh token reuse")
+	}
+}
+
+func TestImpersonationEndsWhenItsSessionExpires(t *testing.T) {
+	setupTestStores(t)
+
+	admin := createTestUser(t, "admin@example.com", true)
+	user := createTestUser(t, "user@example.com", true)
+
+	token, impersonation := impersonate(t, admin, user)
+	db.PostDb.Model(&impersonation).Update("expires_at", time.Now().Add(time.Hour))
+
+	if _, _, err := helpers.RotateRefreshToken(context.Background(), token.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	impersonation = reloadImpersonation(t, impersonation)
+	if impersonation.ExpiresAt.Before(time.Now().Add(helpers.RefreshTokenExpiry - time.Minute)) {
+		t.Fatalf("refreshing left the impersonation expiring at %v", impersonation.ExpiresAt)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	impersonation.ExpiresAt = expired
+	if end := impersonation.End(); end == nil || !end.Equal(expired) {
+		t.Fatalf("expired impersonation ended at %v", end)
+	}
+}
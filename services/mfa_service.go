@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+const recoveryCodeCount = 10
+
+func SetupMfa(r *http.Request) (response responses.MfaSetupResponse, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	if user.TwoFactorEnabled() {
+		return response, customizedError.ErrMfaAlreadyEnabled, http.StatusConflict
+	}
+
+	secret, err := helpers.GenerateTotpSecret()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// the secret only lands on the user once a code from it is confirmed
+	err = db.Redis.Set(r.Context(), "mfa_setup_"+user.Id, secret, time.Minute*10).Err()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.MfaSetupResponse{
+		Secret: secret,
+		Uri:    helpers.TotpUri(secret, user.Email),
+	}, nil, http.StatusOK
+}
+
+func ConfirmMfa(
+	r *http.Request,
+	payload request.ConfirmMfa,
+) (response responses.RecoveryCodesResponse, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+	setupKey := "mfa_setup_" + user.Id
+
+	if user.TwoFactorEnabled() {
+		return response, customizedError.ErrMfaAlreadyEnabled, http.StatusConflict
+	}
+
+	secret, err := db.Redis.Get(r.Context(), setupKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return response, customizedError.ErrMfaSetupNotStarted, http.StatusBadRequest
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if !helpers.ValidateTotpCode(secret, payload.Code) {
+		return response, customizedError.ErrInvalidMfaCode, http.StatusBadRequest
+	}
+
+	codes, err := helpers.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = db.PostDb.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_secret":     secret,
+			"two_factor_enabled_at": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, user.Id, codes)
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	_ = db.Redis.Del(r.Context(), setupKey).Err()
+
+	return responses.RecoveryCodesResponse{RecoveryCodes: codes}, nil, http.StatusOK
+}
+
+func DisableMfa(
+	r *http.Request,
+	payload request.DisableMfa,
+) (message map[string]string, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	if !user.TwoFactorEnabled() {
+		return nil, customizedError.ErrMfaNotEnabled, http.StatusBadRequest
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
+		return nil, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
+	}
+
+	valid, err := verifySecondFactor(r.Context(), user, payload.Code)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if !valid {
+		return nil, customizedError.ErrInvalidMfaCode, http.StatusBadRequest
+	}
+
+	err = db.PostDb.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_secret":     "",
+			"two_factor_enabled_at": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.Id).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Two Factor Disabled"), nil, http.StatusOK
+}
+
+func VerifyMfa(
+	payload request.VerifyMfa,
+	device helpers.Device,
+) (response responses.AuthResponse, err error, status int) {
+	var user models.User
+	ctx := context.Background()
+
+	userId, err := helpers.GetMfaChallenge(ctx, payload.MfaToken)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidMfaChallenge) {
+			return response, err, http.StatusUnauthorized
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// deleted accounts are looked up too, LoginUser hands out challenges
+	// during the grace period and passing one restores the account
+	err = db.PostDb.Unscoped().Where("id = ?", userId).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response, customizedError.ErrInvalidMfaChallenge, http.StatusUnauthorized
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if user.DeletedAt.Valid && time.Since(user.DeletedAt.Time) >= db.AuthConfig.DeletionGracePeriod {
+		return response, customizedError.ErrInvalidMfaChallenge, http.StatusUnauthorized
+	}
+
+	if user.Disabled() {
+		return response, customizedError.ErrAccountDisabled, http.StatusForbidden
+	}
+
+	// every password login hands out a fresh challenge, so its own attempt
+	// cap is not enough; wrong codes count towards the account lockout too
+	if err = helpers.CheckLoginThrottle(ctx, user.Id, device.IpAddress); err != nil {
+		err, status = loginThrottleError(err)
+		return response, err, status
+	}
+
+	valid, err := verifySecondFactor(ctx, user, payload.Code)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if !valid {
+		if err = helpers.FailMfaChallenge(ctx, payload.MfaToken); err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+		if err = helpers.RecordLoginFailure(ctx, &user, device.IpAddress); err != nil {
+			err, status = loginThrottleError(err)
+			return response, err, status
+		}
+		return response, customizedError.ErrInvalidMfaCode, http.StatusUnauthorized
+	}
+
+	if err = helpers.DeleteMfaChallenge(ctx, payload.MfaToken); err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if err = helpers.ClearLoginFailures(ctx, user.Id); err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if err = restoreDeletedUser(&user); err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	token, err := helpers.GenerateAccessToken(ctx, user.Id, device)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateAuthResponse(token, user), nil, http.StatusOK
+}
+
+// verifySecondFactor accepts either a current TOTP code or one of the
+// user's unused recovery codes.
+func verifySecondFactor(ctx context.Context, user models.User, code string) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	if len(code) == 6 {
+		return helpers.ConsumeTotpCode(ctx, user.Id, user.TwoFactorSecret, code)
+	}
+
+	var recoveryCodes []models.RecoveryCode
+	err := db.PostDb.Where("user_id = ? AND used_at IS NULL", user.Id).Find(&recoveryCodes).Error
+	if err != nil {
+		return false, err
+	}
+
+	for _, recoveryCode := range recoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(recoveryCode.CodeHash), []byte(code)) != nil {
+			continue
+		}
+
+		// guard against the same code being redeemed by two requests at once
+		result := db.PostDb.Model(&models.RecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", recoveryCode.Id).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	return false, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId string, codes []string) error {
+	err := tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error
+	if err != nil {
+		return err
+	}
+
+	recoveryCodes := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		recoveryCodes = append(recoveryCodes, models.RecoveryCode{
+			Id:        uuid.New().String(),
+			UserId:    userId,
+			CodeHash:  string(hashed),
+			CreatedAt: time.Now(),
+		})
+	}
+
+	return tx.Create(&recoveryCodes).Error
+}
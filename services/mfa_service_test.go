@@ -0,0 +1,153 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+// totpNow is what an authenticator app shows for the secret right now.
+func totpNow(t *testing.T, secret string) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// enableMfa goes through setup and confirmation, returning the secret and
+// the recovery codes.
+func enableMfa(t *testing.T, user models.User) (string, []string) {
+	t.Helper()
+
+	setup, err, status := SetupMfa(authenticated(t, user.Id, httptest.NewRequest(http.MethodPost, "/user/mfa/setup", nil)))
+	if err != nil {
+		t.Fatalf("setup = %v, %d", err, status)
+	}
+
+	confirm := func(code string) (responses.RecoveryCodesResponse, error, int) {
+		r := authenticated(t, user.Id, httptest.NewRequest(http.MethodPost, "/user/mfa/confirm", nil))
+		return ConfirmMfa(r, request.ConfirmMfa{Code: code})
+	}
+
+	if _, err, status = confirm("000000"); !errors.Is(err, customizedError.ErrInvalidMfaCode) {
+		t.Fatalf("confirming with a wrong code = %v, %d", err, status)
+	}
+	codes, err, status := confirm(totpNow(t, setup.Secret))
+	if err != nil || len(codes.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("confirm = %v, %v, %d", codes, err, status)
+	}
+	return setup.Secret, codes.RecoveryCodes
+}
+
+// mfaChallenge signs in with the password and returns the challenge handed
+// out in place of tokens.
+func mfaChallenge(t *testing.T, user models.User) string {
+	t.Helper()
+
+	response, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, homeDevice)
+	if err != nil || !response.MfaRequired || response.Token != "" {
+		t.Fatalf("login = %+v, %v, %d", response, err, status)
+	}
+	return response.MfaToken
+}
+
+func TestMfaLoginWithTotpCode(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "totp@example.com", true)
+	secret, _ := enableMfa(t, user)
+
+	code := totpNow(t, secret)
+	challenge := mfaChallenge(t, user)
+	response, err, status := VerifyMfa(request.VerifyMfa{MfaToken: challenge, Code: code}, homeDevice)
+	if err != nil || signedInAs(response.Token) != user.Id {
+		t.Fatalf("verify = %v, %d", err, status)
+	}
+
+	// neither the challenge nor the code can be used twice
+	_, err, status = VerifyMfa(request.VerifyMfa{MfaToken: challenge, Code: totpNow(t, secret)}, homeDevice)
+	if !errors.Is(err, customizedError.ErrInvalidMfaChallenge) || status != http.StatusUnauthorized {
+		t.Fatalf("reused challenge = %v, %d", err, status)
+	}
+	_, err, status = VerifyMfa(request.VerifyMfa{MfaToken: mfaChallenge(t, user), Code: code}, homeDevice)
+	if !errors.Is(err, customizedError.ErrInvalidMfaCode) || status != http.StatusUnauthorized {
+		t.Fatalf("replayed code = %v, %d", err, status)
+	}
+}
+
+func TestMfaRecoveryCodesWorkOnce(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "recovery@example.com", true)
+	_, recoveryCodes := enableMfa(t, user)
+
+	// codes are typed back in whatever case and spacing
+	code := " " + strings.ToUpper(recoveryCodes[0]) + " "
+	if _, err, status := VerifyMfa(request.VerifyMfa{MfaToken: mfaChallenge(t, user), Code: code}, homeDevice); err != nil {
+		t.Fatalf("recovery code = %v, %d", err, status)
+	}
+
+	_, err, status := VerifyMfa(request.VerifyMfa{MfaToken: mfaChallenge(t, user), Code: recoveryCodes[0]}, homeDevice)
+	if !errors.Is(err, customizedError.ErrInvalidMfaCode) {
+		t.Fatalf("used recovery code = %v, %d", err, status)
+	}
+
+	var unused int64
+	db.PostDb.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.Id).Count(&unused)
+	if unused != recoveryCodeCount-1 {
+		t.Fatalf("%d unused recovery codes", unused)
+	}
+}
+
+func TestDisableMfaNeedsPasswordAndCode(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "disable@example.com", true)
+	secret, _ := enableMfa(t, user)
+
+	disable := func(payload request.DisableMfa) (error, int) {
+		r := authenticated(t, user.Id, httptest.NewRequest(http.MethodPost, "/user/mfa/disable", nil))
+		_, err, status := DisableMfa(r, payload)
+		return err, status
+	}
+
+	if err, status := disable(request.DisableMfa{Password: "wrong", Code: totpNow(t, secret)}); status != http.StatusUnauthorized {
+		t.Fatalf("disabling with a wrong password = %v, %d", err, status)
+	}
+	if err, status := disable(request.DisableMfa{Password: testPassword, Code: "000000"}); status != http.StatusBadRequest {
+		t.Fatalf("disabling with a wrong code = %v, %d", err, status)
+	}
+	if err, status := disable(request.DisableMfa{Password: testPassword, Code: totpNow(t, secret)}); err != nil {
+		t.Fatalf("disable = %v, %d", err, status)
+	}
+
+	response, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, homeDevice)
+	if err != nil || response.MfaRequired {
+		t.Fatalf("login once disabled = %+v, %v, %d", response, err, status)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+// CreateOAuthClient registers a client. The secret of a confidential client
+// is only ever returned here and by RotateOAuthClientSecret.
+func CreateOAuthClient(
+	payload request.CreateOAuthClient,
+) (response responses.OAuthClientResponse, err error, status int) {
+	for _, redirectUri := range payload.RedirectUris {
+		parsed, err := url.Parse(redirectUri)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Fragment != "" {
+			return response, customizedError.ErrInvalidRedirectUri, http.StatusUnprocessableEntity
+		}
+	}
+
+	for _, grantType := range payload.GrantTypes {
+		if !slices.Contains(supportedGrantTypes, grantType) {
+			return response, customizedError.ErrUnsupportedGrantType, http.StatusUnprocessableEntity
+		}
+	}
+
+	if payload.Public && slices.Contains(payload.GrantTypes, grantClientCredentials) {
+		return response, customizedError.ErrUnauthorizedClient, http.StatusUnprocessableEntity
+	}
+
+	for _, scope := range payload.Scopes {
+		if !slices.Contains(supportedScopes, scope) {
+			return response, customizedError.ErrInvalidScope, http.StatusUnprocessableEntity
+		}
+	}
+
+	client := models.OAuthClient{
+		Id:           uuid.New().String(),
+		Name:         payload.Name,
+		RedirectUris: strings.Join(payload.RedirectUris, " "),
+		GrantTypes:   strings.Join(payload.GrantTypes, " "),
+		Scopes:       strings.Join(payload.Scopes, " "),
+		Public:       payload.Public,
+	}
+
+	var secret string
+	if !client.Public {
+		secret, client.SecretHash, err = generateClientSecret()
+		if err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	if err = db.PostDb.Create(&client).Error; err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = responses.GenerateOAuthClientResponse(client)
+	response.ClientSecret = secret
+
+	return response, nil, http.StatusCreated
+}
+
+func ListOAuthClients() (response []responses.OAuthClientResponse, err error, status int) {
+	var clients []models.OAuthClient
+
+	if err = db.PostDb.Order("created_at").Find(&clients).Error; err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, responses.GenerateOAuthClientResponse(client))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+// RotateOAuthClientSecret replaces the secret of a confidential client;
+// the old one stops working straight away.
+func RotateOAuthClientSecret(r *http.Request) (response responses.OAuthClientResponse, err error, status int) {
+	client, err, status := findOAuthClient(chi.URLParam(r, "id"))
+	if err != nil {
+		return response, err, status
+	}
+
+	if client.Public {
+		return response, customizedError.ErrInvalidClient, http.StatusBadRequest
+	}
+
+	secret, secretHash, err := generateClientSecret()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if err = db.PostDb.Model(&client).Update("secret_hash", secretHash).Error; err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = responses.GenerateOAuthClientResponse(client)
+	response.ClientSecret = secret
+
+	return response, nil, http.StatusOK
+}
+
+func DeleteOAuthClient(r *http.Request) (message map[string]string, err error, status int) {
+	client, err, status := findOAuthClient(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, err, status
+	}
+
+	if err = db.PostDb.Delete(&client).Error; err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("OAuth Client Deleted"), nil, http.StatusOK
+}
+
+func generateClientSecret() (secret, secretHash string, err error) {
+	secret = strings.ReplaceAll(uuid.New().String()+uuid.New().String(), "-", "")
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, string(hashed), nil
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/oauth"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+func StartOAuth(r *http.Request) (response responses.OAuthRedirectResponse, err error, status int) {
+	return oauthRedirect(r, "")
+}
+
+func LinkOAuth(r *http.Request) (response responses.OAuthRedirectResponse, err error, status int) {
+	return oauthRedirect(r, middlewares.GetUserId(r.Context()))
+}
+
+// OAuthCallback completes a flow started by StartOAuth or LinkOAuth. A
+// sign in answers with the same responses.AuthResponse as LoginUser, a
+// link with the linked identity.
+func OAuthCallback(r *http.Request) (response interface{}, err error, status int) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	provider, ok := oauth.Get(chi.URLParam(r, "provider"))
+	if !ok {
+		return nil, customizedError.ErrUnknownOAuthProvider, http.StatusNotFound
+	}
+
+	// a state handed out to another browser would let its owner finish
+	// their own sign in, or link, in this one
+	if !helpers.ValidOAuthStateCookie(r, query.Get("state")) {
+		return nil, customizedError.ErrInvalidOAuthState, http.StatusBadRequest
+	}
+
+	state, err := helpers.ConsumeOAuthState(ctx, query.Get("state"), provider.Name())
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidOAuthState) {
+			return nil, err, http.StatusBadRequest
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// a link is only completed for the user who started it, still signed in
+	if state.UserId != "" && helpers.RequestUserId(r) != state.UserId {
+		return nil, customizedError.ErrInvalidOAuthState, http.StatusUnauthorized
+	}
+
+	identity, err := provider.Exchange(ctx, query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusBadGateway
+	}
+
+	if state.UserId != "" {
+		linked, err, status := linkIdentity(state.UserId, provider.Name(), identity)
+		if err != nil {
+			return nil, err, status
+		}
+		return responses.GenerateLinkedIdentityResponse(linked), nil, http.StatusOK
+	}
+
+	device := helpers.DeviceFromRequest(r)
+
+	user, err, status := findOrCreateOAuthUser(provider.Name(), identity, device)
+	if err != nil {
+		return nil, err, status
+	}
+
+	return signIn(user, device, "oauth", user.TwoFactorEnabled())
+}
+
+func GetLinkedIdentities(
+	r *http.Request,
+) (response []responses.LinkedIdentityResponse, err error, status int) {
+	var identities []models.LinkedIdentity
+	userId := middlewares.GetUserId(r.Context())
+
+	err = db.PostDb.Where("user_id = ?", userId).Order("created_at").Find(&identities).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.LinkedIdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, responses.GenerateLinkedIdentityResponse(identity))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+func UnlinkOAuth(r *http.Request) (message map[string]string, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	err = db.PostDb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND provider = ?", user.Id, chi.URLParam(r, "provider")).
+			Delete(&models.LinkedIdentity{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return customizedError.ErrIdentityNotLinked
+		}
+
+		if user.HasPassword() {
+			return nil
+		}
+
+		// counted after the delete, so two unlinks at once can not both pass
+		var remaining int64
+		for _, model := range []interface{}{&models.LinkedIdentity{}, &models.Passkey{}} {
+			var count int64
+			if err := tx.Model(model).Where("user_id = ?", user.Id).Count(&count).Error; err != nil {
+				return err
+			}
+			remaining += count
+		}
+		if remaining == 0 {
+			return customizedError.ErrLastSignInMethod
+		}
+		return nil
+	})
+	if errors.Is(err, customizedError.ErrIdentityNotLinked) {
+		return nil, err, http.StatusNotFound
+	}
+	if errors.Is(err, customizedError.ErrLastSignInMethod) {
+		return nil, err, http.StatusConflict
+	}
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Provider Unlinked"), nil, http.StatusOK
+}
+
+func oauthRedirect(
+	r *http.Request,
+	userId string,
+) (response responses.OAuthRedirectResponse, err error, status int) {
+	provider, ok := oauth.Get(chi.URLParam(r, "provider"))
+	if !ok {
+		return response, customizedError.ErrUnknownOAuthProvider, http.StatusNotFound
+	}
+
+	state, err := helpers.CreateOAuthState(r.Context(), provider.Name(), userId)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	authorizationUrl, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusBadGateway
+	}
+
+	return responses.OAuthRedirectResponse{AuthorizationUrl: authorizationUrl, State: state.State}, nil, http.StatusOK
+}
+
+func linkIdentity(
+	userId, provider string,
+	identity oauth.Identity,
+) (linked models.LinkedIdentity, err error, status int) {
+	err = db.PostDb.Where("provider = ? AND subject = ?", provider, identity.Subject).
+		Find(&linked).Error
+	if err != nil {
+		return linked, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if linked.Id != "" {
+		if linked.UserId != userId {
+			return linked, customizedError.ErrIdentityAlreadyLinked, http.StatusConflict
+		}
+		return linked, nil, http.StatusOK
+	}
+
+	linked = models.LinkedIdentity{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		Provider:  provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	// replaces a previously linked account from the same provider
+	err = db.PostDb.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND provider = ?", userId, provider).
+			Delete(&models.LinkedIdentity{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&linked).Error
+	})
+	if err != nil {
+		return linked, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return linked, nil, http.StatusOK
+}
+
+// findOrCreateOAuthUser resolves the identity to a user, first through an
+// existing link, then by verified email, and finally by registering a new
+// already verified user. An unverified account with the email is claimed,
+// see claimUnverifiedUser.
+func findOrCreateOAuthUser(
+	provider string,
+	identity oauth.Identity,
+	device helpers.Device,
+) (user models.User, err error, status int) {
+	var linked models.LinkedIdentity
+
+	err = db.PostDb.Where("provider = ? AND subject = ?", provider, identity.Subject).
+		Find(&linked).Error
+	if err != nil {
+		return user, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if linked.Id != "" {
+		err = db.PostDb.Where("id = ?", linked.UserId).First(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return user, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
+			}
+			return user, helpers.ServerError(err), http.StatusInternalServerError
+		}
+		return user, nil, http.StatusOK
+	}
+
+	// an unverified email could be used to take over someone else's account
+	if identity.Email == "" || !identity.EmailVerified {
+		return user, customizedError.ErrOAuthEmailNotVerified, http.StatusUnauthorized
+	}
+
+	_ = db.PostDb.Unscoped().Where("email = ?", identity.Email).Find(&user)
+
+	if user.DeletedAt.Valid {
+		return models.User{}, customizedError.ErrEmaiAlreadyTaken, http.StatusNotAcceptable
+	}
+
+	if user.Empty() {
+		user, err = createOAuthUser(identity, device)
+		if err != nil {
+			return user, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	if !user.EmailVerified() {
+		if err = claimUnverifiedUser(&user); err != nil {
+			return user, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	if _, err, status = linkIdentity(user.Id, provider, identity); err != nil {
+		return user, err, status
+	}
+
+	return user, nil, http.StatusOK
+}
+
+// claimUnverifiedUser hands an account nobody proved the email of to the
+// provider's verified owner of that email. Whoever registered it may not
+// be them, so everything they could sign in with is removed: the password,
+// mfa, passkeys, api keys, other linked identities and every session.
+func claimUnverifiedUser(user *models.User) error {
+	now := time.Now()
+	err := db.PostDb.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+			"password":              "",
+			"email_verified_at":     now,
+			"two_factor_secret":     "",
+			"two_factor_enabled_at": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&models.RecoveryCode{}, &models.Passkey{}, &models.ApiKey{}, &models.LinkedIdentity{},
+		} {
+			if err := tx.Where("user_id = ?", user.Id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	user.Password = ""
+	user.EmailVerifiedAt = &now
+	user.TwoFactorSecret = ""
+	user.TwoFactorEnabledAt = nil
+
+	return helpers.RevokeUserTokens(context.Background(), user.Id)
+}
+
+func createOAuthUser(identity oauth.Identity, device helpers.Device) (models.User, error) {
+	name := identity.Name
+	if name == "" {
+		name = identity.Email
+	}
+
+	// no password until the user sets one with forgot password, bcrypt
+	// never matches the empty hash
+	now := time.Now()
+	user := models.User{
+		Id:              uuid.New().String(),
+		Name:            name,
+		Email:           identity.Email,
+		EmailVerifiedAt: &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	if err := db.PostDb.Create(&user).Error; err != nil {
+		return user, err
+	}
+
+	// as on registration, the device the account was made on is not new
+	_, err := helpers.RememberDevice(context.Background(), user.Id, device)
+	return user, err
+}
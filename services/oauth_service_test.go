@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+
+	"github.com/dudeiebot/ad-ly/audit"
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/oauth"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+const (
+	stubProvider = "stub"
+	stubClientId = "stub-client"
+)
+
+// stubIdp is an OpenID Connect issuer that hands out an id_token for
+// whatever identity and nonce the test sets.
+type stubIdp struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu       sync.Mutex
+	identity oauth.Identity
+	nonce    string
+}
+
+func newStubIdp(t *testing.T) *stubIdp {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &stubIdp{key: key}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "stub",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+
+		idp.mu.Lock()
+		identity, nonce := idp.identity, idp.nonce
+		idp.mu.Unlock()
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            stubClientId,
+			"sub":            identity.Subject,
+			"email":          identity.Email,
+			"email_verified": identity.EmailVerified,
+			"name":           identity.Name,
+			"nonce":          nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "stub"
+
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "stub-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// signInAs makes the next token response carry identity and nonce.
+func (idp *stubIdp) signInAs(identity oauth.Identity, nonce string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	idp.identity, idp.nonce = identity, nonce
+}
+
+func setupOAuthTest(t *testing.T) *stubIdp {
+	t.Helper()
+
+	setupTestStores(t)
+
+	idp := newStubIdp(t)
+	oauth.Register(oauth.NewOidcProvider(stubProvider, idp.server.URL, stubClientId, "stub-secret",
+		"http://localhost/auth/oauth/stub/callback"))
+
+	return idp
+}
+
+func oauthRequest(target string, cookies ...*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("provider", stubProvider)
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+}
+
+// startOAuth runs StartOAuth, or LinkOAuth for userId, and returns the
+// state and the nonce sent to the provider.
+func startOAuth(t *testing.T, userId string) (string, string) {
+	t.Helper()
+
+	var (
+		response responses.OAuthRedirectResponse
+		err      error
+	)
+	if userId == "" {
+		response, err, _ = StartOAuth(oauthRequest("/auth/oauth/stub"))
+	} else {
+		response, err, _ = LinkOAuth(authenticated(t, userId, oauthRequest("/user/identities/stub")))
+	}
+	if err != nil {
+		t.Fatalf("starting the flow: %v", err)
+	}
+
+	authorizationUrl, err := url.Parse(response.AuthorizationUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorizationUrl.Query()
+
+	if query.Get("state") != response.State || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization url is missing the state or pkce challenge: %s", response.AuthorizationUrl)
+	}
+
+	return response.State, query.Get("nonce")
+}
+
+func callback(state string, cookies ...*http.Cookie) (interface{}, error, int) {
+	return OAuthCallback(oauthRequest("/auth/oauth/stub/callback?code=stub-code&state="+state, cookies...))
+}
+
+func stateCookie(state string) *http.Cookie {
+	return &http.Cookie{Name: helpers.OAuthStateCookie, Value: state}
+}
+
+func TestOAuthCallbackSignsInNewUser(t *testing.T) {
+	idp := setupOAuthTest(t)
+
+	state, nonce := startOAuth(t, "")
+	idp.signInAs(oauth.Identity{Subject: "sub-1", Email: "new@example.com", EmailVerified: true, Name: "New"}, nonce)
+
+	response, err, status := callback(state, stateCookie(state))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("callback = %v, %d", err, status)
+	}
+
+	auth, ok := response.(responses.AuthResponse)
+	if !ok || auth.Token == "" {
+		t.Fatalf("expected tokens, got %#v", response)
+	}
+
+	var linked models.LinkedIdentity
+	db.PostDb.Where("provider = ? AND subject = ?", stubProvider, "sub-1").Find(&linked)
+	if linked.UserId == "" {
+		t.Fatal("identity was not linked")
+	}
+
+	var user models.User
+	db.PostDb.Where("id = ?", linked.UserId).First(&user)
+	if user.HasPassword() {
+		t.Fatal("a user made through a provider has a password")
+	}
+
+	events := auditEvents(t, audit.ActionLoginSucceeded)
+	if len(events) != 1 || events[0].Metadata["method"] != "oauth" || events[0].ActorId != linked.UserId {
+		t.Fatalf("audited %+v", events)
+	}
+
+	// the state is single use
+	if _, err, status = callback(state, stateCookie(state)); status != http.StatusBadRequest {
+		t.Fatalf("replayed callback = %v, %d", err, status)
+	}
+}
+
+func TestOAuthCallbackRejectsMissingOrMismatchedStateCookie(t *testing.T) {
+	idp := setupOAuthTest(t)
+
+	state, nonce := startOAuth(t, "")
+	idp.signInAs(oauth.Identity{Subject: "sub-1", Email: "new@example.com", EmailVerified: true}, nonce)
+
+	if _, err, status := callback(state); !errors.Is(err, customizedError.ErrInvalidOAuthState) || status != http.StatusBadRequest {
+		t.Fatalf("callback without cookie = %v, %d", err, status)
+	}
+
+	otherState, _ := startOAuth(t, "")
+	if _, err, status := callback(state, stateCookie(otherState)); !errors.Is(err, customizedError.ErrInvalidOAuthState) || status != http.StatusBadRequest {
+		t.Fatalf("callback with another flow's cookie = %v, %d", err, status)
+	}
+
+	// neither attempt consumed the state
+	if _, err, status := callback(state, stateCookie(state)); err != nil || status != http.StatusOK {
+		t.Fatalf("callback = %v, %d", err, status)
+	}
+}
+
+func TestOAuthCallbackRejectsNonceMismatch(t *testing.T) {
+	idp := setupOAuthTest(t)
+
+	state, _ := startOAuth(t, "")
+	idp.signInAs(oauth.Identity{Subject: "sub-1", Email: "new@example.com", EmailVerified: true}, "another-nonce")
+
+	if _, err, status := callback(state, stateCookie(state)); err == nil || status != http.StatusBadGateway {
+		t.Fatalf("callback = %v, %d", err, status)
+	}
+
+	var count int64
+	db.PostDb.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d users were created", count)
+	}
+}
+
+func TestOAuthCallbackLinkRequiresTheStartingUser(t *testing.T) {
+	idp := setupOAuthTest(t)
+
+	user := createTestUser(t, "owner@example.com", true)
+	other := createTestUser(t, "other@example.com", true)
+
+	token, err := helpers.GenerateAccessToken(context.Background(), user.Id, helpers.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := helpers.GenerateAccessToken(context.Background(), other.Id, helpers.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, nonce := startOAuth(t, user.Id)
+	idp.signInAs(oauth.Identity{Subject: "sub-link", Email: "someone@example.com", EmailVerified: true}, nonce)
+
+	if _, err, status := callback(state, stateCookie(state)); status != http.StatusUnauthorized {
+		t.Fatalf("link without a session = %v, %d", err, status)
+	}
+
+	state, nonce = startOAuth(t, user.Id)
+	idp.signInAs(oauth.Identity{Subject: "sub-link", Email: "someone@example.com", EmailVerified: true}, nonce)
+
+	if _, err, status := callback(state, stateCookie(state),
+		&http.Cookie{Name: helpers.AccessTokenCookie, Value: otherToken.AccessToken}); status != http.StatusUnauthorized {
+		t.Fatalf("link from another user's session = %v, %d", err, status)
+	}
+
+	state, nonce = startOAuth(t, user.Id)
+	idp.signInAs(oauth.Identity{Subject: "sub-link", Email: "someone@example.com", EmailVerified: true}, nonce)
+
+	response, err, status := callback(state, stateCookie(state),
+		&http.Cookie{Name: helpers.AccessTokenCookie, Value: token.AccessToken})
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("link = %v, %d", err, status)
+	}
+	if _, ok := response.(responses.LinkedIdentityResponse); !ok {
+		t.Fatalf("expected the linked identity, got %#v", response)
+	}
+
+	var linked models.LinkedIdentity
+	db.PostDb.Where("provider = ? AND subject = ?", stubProvider, "sub-link").Find(&linked)
+	if linked.UserId != user.Id {
+		t.Fatalf("identity linked to %q, want %q", linked.UserId, user.Id)
+	}
+}
+
+func TestOAuthCallbackClaimsUnverifiedAccount(t *testing.T) {
+	idp := setupOAuthTest(t)
+
+	squatter := createTestUser(t, "victim@example.com", false)
+	db.PostDb.Create(&models.LinkedIdentity{
+		Id: uuid.New().String(), UserId: squatter.Id, Provider: "other", Subject: "squatter",
+	})
+	token, err := helpers.GenerateAccessToken(context.Background(), squatter.Id, helpers.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, nonce := startOAuth(t, "")
+	idp.signInAs(oauth.Identity{Subject: "sub-victim", Email: "victim@example.com", EmailVerified: true}, nonce)
+
+	if _, err, status := callback(state, stateCookie(state)); err != nil || status != http.StatusOK {
+		t.Fatalf("callback = %v, %d", err, status)
+	}
+
+	var user models.User
+	db.PostDb.Where("id = ?", squatter.Id).First(&user)
+	if user.Password == squatter.Password || user.TwoFactorSecret != "" || !user.EmailVerified() {
+		t.Fatalf("unverified account was linked without being claimed: %#v", user)
+	}
+
+	var identities []models.LinkedIdentity
+	db.PostDb.Where("user_id = ?", squatter.Id).Find(&identities)
+	if len(identities) != 1 || identities[0].Subject != "sub-victim" {
+		t.Fatalf("linked identities = %#v", identities)
+	}
+
+	r := oauthRequest("/", &http.Cookie{Name: helpers.AccessTokenCookie, Value: token.AccessToken})
+	if helpers.RequestUserId(r) != "" {
+		t.Fatal("the previous session survived the claim")
+	}
+}
+
+func unlink(t *testing.T, user models.User, provider string) (error, int) {
+	t.Helper()
+
+	r := authenticated(t, user.Id, httptest.NewRequest(http.MethodDelete, "/auth/oauth/"+provider, nil))
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("provider", provider)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+	_, err, status := UnlinkOAuth(r)
+	return err, status
+}
+
+func TestUnlinkOAuthKeepsASignInMethod(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "linked@example.com", true)
+	db.PostDb.Model(&user).Update("password", "")
+	for _, provider := range []string{"google", "github"} {
+		db.PostDb.Create(&models.LinkedIdentity{
+			Id: uuid.New().String(), UserId: user.Id, Provider: provider, Subject: provider + "-sub",
+		})
+	}
+
+	if err, status := unlink(t, user, "google"); err != nil {
+		t.Fatalf("unlinking one of two providers = %v, %d", err, status)
+	}
+
+	err, status := unlink(t, user, "github")
+	if !errors.Is(err, customizedError.ErrLastSignInMethod) || status != http.StatusConflict {
+		t.Fatalf("unlinking the last provider = %v, %d", err, status)
+	}
+	var remaining int64
+	db.PostDb.Model(&models.LinkedIdentity{}).Where("user_id = ?", user.Id).Count(&remaining)
+	if remaining != 1 {
+		t.Fatalf("%d identities left after a refused unlink", remaining)
+	}
+
+	db.PostDb.Create(&models.Passkey{Id: uuid.New().String(), UserId: user.Id, CredentialId: "credential"})
+	if err, status = unlink(t, user, "github"); err != nil {
+		t.Fatalf("unlinking the last provider with a passkey = %v, %d", err, status)
+	}
+}
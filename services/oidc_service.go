@@ -0,0 +1,278 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantClientCredentials = "client_credentials"
+)
+
+var (
+	supportedGrantTypes = []string{grantAuthorizationCode, grantClientCredentials}
+	supportedScopes     = []string{"openid", "profile", "email"}
+)
+
+func GetOpenIdConfiguration() (response responses.OpenIdConfigurationResponse, err error, status int) {
+	issuer := db.GetApiHost()
+
+	return responses.OpenIdConfigurationResponse{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		JwksUri:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               supportedGrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{db.AuthConfig.JwtAlgorithm},
+		ScopesSupported:                   supportedScopes,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "name", "email", "email_verified"},
+	}, nil, http.StatusOK
+}
+
+// GetJsonWebKeys publishes the public keys our tokens can be verified with.
+// It is empty while tokens are signed with the app key.
+func GetJsonWebKeys() (response responses.JwksResponse, err error, status int) {
+	return responses.JwksResponse{Keys: helpers.JsonWebKeys()}, nil, http.StatusOK
+}
+
+// Authorize issues an authorization code to the signed in user. The login
+// and consent screens live in the frontend, so instead of redirecting it
+// answers with the url the frontend should send the browser to.
+func Authorize(
+	r *http.Request,
+	payload request.Authorize,
+) (response responses.AuthorizeResponse, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	client, err, status := findOAuthClient(payload.ClientId)
+	if err != nil {
+		return response, err, status
+	}
+
+	if !client.AllowsRedirectUri(payload.RedirectUri) {
+		return response, customizedError.ErrInvalidRedirectUri, http.StatusBadRequest
+	}
+
+	if payload.ResponseType != "code" {
+		return response, customizedError.ErrUnsupportedResponseType, http.StatusBadRequest
+	}
+
+	if !client.AllowsGrantType(grantAuthorizationCode) {
+		return response, customizedError.ErrUnauthorizedClient, http.StatusBadRequest
+	}
+
+	scope := payload.Scope
+	if scope == "" {
+		scope = "openid"
+	}
+	if !client.AllowsScopes(scope) {
+		return response, customizedError.ErrInvalidScope, http.StatusBadRequest
+	}
+
+	// public clients have no secret, so PKCE is the only thing tying the
+	// code to the app that asked for it
+	if client.Public && payload.CodeChallenge == "" {
+		return response, customizedError.ErrCodeChallengeRequired, http.StatusBadRequest
+	}
+
+	code, err := helpers.CreateAuthorizationCode(r.Context(), helpers.AuthorizationCode{
+		ClientId:      client.Id,
+		UserId:        user.Id,
+		RedirectUri:   payload.RedirectUri,
+		Scope:         scope,
+		Nonce:         payload.Nonce,
+		CodeChallenge: payload.CodeChallenge,
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	redirect, _ := url.Parse(payload.RedirectUri)
+	query := redirect.Query()
+	query.Set("code", code)
+	if payload.State != "" {
+		query.Set("state", payload.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	return responses.AuthorizeResponse{RedirectTo: redirect.String()}, nil, http.StatusOK
+}
+
+func Token(r *http.Request, payload request.Token) (response responses.TokenResponse, err error, status int) {
+	// client_secret_basic wins over credentials sent in the body
+	if clientId, clientSecret, ok := r.BasicAuth(); ok {
+		payload.ClientId, payload.ClientSecret = clientId, clientSecret
+	}
+
+	client, err, status := authenticateOAuthClient(payload)
+	if err != nil {
+		return response, err, status
+	}
+
+	if !slices.Contains(supportedGrantTypes, payload.GrantType) {
+		return response, customizedError.ErrUnsupportedGrantType, http.StatusBadRequest
+	}
+
+	if !client.AllowsGrantType(payload.GrantType) {
+		return response, customizedError.ErrUnauthorizedClient, http.StatusBadRequest
+	}
+
+	if payload.GrantType == grantClientCredentials {
+		return clientCredentialsToken(client, payload)
+	}
+
+	return authorizationCodeToken(r, client, payload)
+}
+
+// UserInfo answers with the claims the oauth access token was granted.
+func UserInfo(r *http.Request) (response map[string]interface{}, err error, status int) {
+	token := strings.Replace(r.Header.Get("Authorization"), "Bearer ", "", -1)
+
+	claims, err := helpers.ParseOAuthAccessToken(token)
+	if err != nil {
+		return nil, err, http.StatusUnauthorized
+	}
+
+	scope, _ := claims["scope"].(string)
+	if !slices.Contains(strings.Fields(scope), "openid") {
+		return nil, customizedError.ErrInvalidScope, http.StatusForbidden
+	}
+
+	var user models.User
+	subject, _ := claims["sub"].(string)
+	_ = db.PostDb.Where("id = ?", subject).Find(&user)
+	if user.Empty() || user.Disabled() {
+		return nil, customizedError.ErrInvalidAccessToken, http.StatusUnauthorized
+	}
+
+	return helpers.UserInfoClaims(user, scope), nil, http.StatusOK
+}
+
+func authorizationCodeToken(
+	r *http.Request,
+	client models.OAuthClient,
+	payload request.Token,
+) (response responses.TokenResponse, err error, status int) {
+	grant, err := helpers.ConsumeAuthorizationCode(r.Context(), payload.Code, client.Id)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidGrant) {
+			return response, err, http.StatusBadRequest
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if grant.RedirectUri != payload.RedirectUri {
+		return response, customizedError.ErrInvalidGrant, http.StatusBadRequest
+	}
+
+	if grant.CodeChallenge != "" && !helpers.VerifyCodeChallenge(payload.CodeVerifier, grant.CodeChallenge) {
+		return response, customizedError.ErrInvalidGrant, http.StatusBadRequest
+	}
+
+	var user models.User
+	_ = db.PostDb.Where("id = ?", grant.UserId).Find(&user)
+	if user.Empty() || user.Disabled() {
+		return response, customizedError.ErrInvalidGrant, http.StatusBadRequest
+	}
+
+	accessToken, err := helpers.SignOAuthAccessToken(user.Id, client.Id, grant.Scope)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = responses.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(helpers.AccessTokenExpiry.Seconds()),
+		Scope:       grant.Scope,
+	}
+
+	if slices.Contains(strings.Fields(grant.Scope), "openid") {
+		response.IdToken, err = helpers.SignIdToken(user, client.Id, grant.Scope, grant.Nonce)
+		if err != nil {
+			return response, helpers.ServerError(err), http.StatusInternalServerError
+		}
+	}
+
+	return response, nil, http.StatusOK
+}
+
+func clientCredentialsToken(
+	client models.OAuthClient,
+	payload request.Token,
+) (response responses.TokenResponse, err error, status int) {
+	scope := payload.Scope
+	if scope == "" {
+		scope = client.Scopes
+	}
+	if !client.AllowsScopes(scope) {
+		return response, customizedError.ErrInvalidScope, http.StatusBadRequest
+	}
+
+	accessToken, err := helpers.SignOAuthAccessToken(client.Id, client.Id, scope)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(helpers.AccessTokenExpiry.Seconds()),
+		Scope:       scope,
+	}, nil, http.StatusOK
+}
+
+// authenticateOAuthClient checks the client secret of confidential
+// clients. Public clients only identify themselves and prove possession of
+// the code through PKCE instead.
+func authenticateOAuthClient(payload request.Token) (client models.OAuthClient, err error, status int) {
+	_ = db.PostDb.Where("id = ?", payload.ClientId).Find(&client)
+	if client.Empty() {
+		return client, customizedError.ErrInvalidClient, http.StatusUnauthorized
+	}
+
+	if client.Public {
+		if payload.GrantType == grantAuthorizationCode && payload.CodeVerifier == "" {
+			return client, customizedError.ErrCodeChallengeRequired, http.StatusBadRequest
+		}
+		return client, nil, http.StatusOK
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(payload.ClientSecret)) != nil {
+		return client, customizedError.ErrInvalidClient, http.StatusUnauthorized
+	}
+
+	return client, nil, http.StatusOK
+}
+
+func findOAuthClient(clientId string) (client models.OAuthClient, err error, status int) {
+	err = db.PostDb.Where("id = ?", clientId).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return client, customizedError.ErrOAuthClientNotFound, http.StatusNotFound
+		}
+		return client, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return client, nil, http.StatusOK
+}
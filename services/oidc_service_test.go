@@ -0,0 +1,222 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+)
+
+const (
+	testRedirectUri  = "https://app.example.com/callback"
+	testClientSecret = "client-secret"
+)
+
+func createTestOAuthClient(t *testing.T, public bool, grantTypes string) models.OAuthClient {
+	t.Helper()
+
+	client := models.OAuthClient{
+		Id:           uuid.New().String(),
+		Name:         "Test App",
+		RedirectUris: testRedirectUri,
+		GrantTypes:   grantTypes,
+		Scopes:       "openid profile email",
+		Public:       public,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if !public {
+		secretHash, err := bcrypt.GenerateFromPassword([]byte(testClientSecret), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SecretHash = string(secretHash)
+	}
+
+	if err := db.PostDb.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizationCode runs Authorize for the user and returns the code from
+// the url the frontend is sent to.
+func authorizationCode(t *testing.T, user models.User, payload request.Authorize) string {
+	t.Helper()
+
+	r := authenticated(t, user.Id, httptest.NewRequest(http.MethodGet, "/oauth/authorize", nil))
+	response, err, status := Authorize(r, payload)
+	if err != nil {
+		t.Fatalf("authorize: %v (%d)", err, status)
+	}
+
+	redirect, err := url.Parse(response.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := redirect.Query().Get("state"); got != payload.State {
+		t.Fatalf("expected state %q back, got %q", payload.State, got)
+	}
+	return redirect.Query().Get("code")
+}
+
+func exchangeCode(clientId, code, verifier string) (string, string, error, int) {
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", nil)
+	response, err, status := Token(r, request.Token{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectUri:  testRedirectUri,
+		CodeVerifier: verifier,
+		ClientId:     clientId,
+	})
+	return response.AccessToken, response.IdToken, err, status
+}
+
+func TestAuthorizationCodeFlowWithPkce(t *testing.T) {
+	setupTestStores(t)
+	useSigningAlgorithm(t, jwt.SigningMethodEdDSA.Alg())
+
+	user := createTestUser(t, "user@example.com", true)
+	client := createTestOAuthClient(t, true, "authorization_code")
+	verifier := "a-verifier-long-enough-to-be-hard-to-guess"
+	authorize := request.Authorize{
+		ClientId:      client.Id,
+		RedirectUri:   testRedirectUri,
+		ResponseType:  "code",
+		Scope:         "openid email",
+		State:         "xyz",
+		Nonce:         "n-0S6",
+		CodeChallenge: codeChallenge(verifier),
+	}
+
+	// a code stolen on the way back is useless without the verifier, and
+	// burned by trying
+	code := authorizationCode(t, user, authorize)
+	if _, _, err, status := exchangeCode(client.Id, code, "wrong-verifier"); err != customizedError.ErrInvalidGrant || status != http.StatusBadRequest {
+		t.Fatalf("expected the wrong verifier to be refused, got %v (%d)", err, status)
+	}
+	if _, _, err, _ := exchangeCode(client.Id, code, verifier); err != customizedError.ErrInvalidGrant {
+		t.Fatalf("expected the burned code to be refused, got %v", err)
+	}
+
+	code = authorizationCode(t, user, authorize)
+	accessToken, idToken, err, status := exchangeCode(client.Id, code, verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v (%d)", err, status)
+	}
+
+	claims, err := helpers.ParseClaims(idToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != user.Id || claims["aud"] != client.Id || claims["nonce"] != "n-0S6" || claims["email"] != user.Email {
+		t.Fatalf("unexpected id token claims: %v", claims)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	info, err, status := UserInfo(r)
+	if err != nil {
+		t.Fatalf("userinfo: %v (%d)", err, status)
+	}
+	if info["sub"] != user.Id || info["email"] != user.Email {
+		t.Fatalf("unexpected userinfo: %v", info)
+	}
+	if _, ok := info["name"]; ok {
+		t.Fatal("expected no profile claims without the profile scope")
+	}
+
+	if _, _, err, _ = exchangeCode(client.Id, code, verifier); err != customizedError.ErrInvalidGrant {
+		t.Fatalf("expected the code to work once, got %v", err)
+	}
+}
+
+func TestAuthorizeChecksTheClientRegistration(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "user@example.com", true)
+	client := createTestOAuthClient(t, true, "authorization_code")
+	r := authenticated(t, user.Id, httptest.NewRequest(http.MethodGet, "/oauth/authorize", nil))
+
+	for name, test := range map[string]struct {
+		payload request.Authorize
+		err     error
+	}{
+		"unregistered redirect uri": {
+			request.Authorize{ClientId: client.Id, RedirectUri: "https://evil.example.com/callback", ResponseType: "code", CodeChallenge: "challenge"},
+			customizedError.ErrInvalidRedirectUri,
+		},
+		"unregistered scope": {
+			request.Authorize{ClientId: client.Id, RedirectUri: testRedirectUri, ResponseType: "code", Scope: "openid admin", CodeChallenge: "challenge"},
+			customizedError.ErrInvalidScope,
+		},
+		"public client without pkce": {
+			request.Authorize{ClientId: client.Id, RedirectUri: testRedirectUri, ResponseType: "code"},
+			customizedError.ErrCodeChallengeRequired,
+		},
+	} {
+		if _, err, status := Authorize(r, test.payload); err != test.err || status != http.StatusBadRequest {
+			t.Errorf("%s: expected %v, got %v (%d)", name, test.err, err, status)
+		}
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	setupTestStores(t)
+
+	client := createTestOAuthClient(t, false, "client_credentials")
+	payload := request.Token{GrantType: "client_credentials", Scope: "email"}
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", nil)
+	r.SetBasicAuth(client.Id, "not-the-secret")
+	if _, err, status := Token(r, payload); err != customizedError.ErrInvalidClient || status != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong secret to be refused, got %v (%d)", err, status)
+	}
+
+	r.SetBasicAuth(client.Id, testClientSecret)
+	response, err, status := Token(r, payload)
+	if err != nil {
+		t.Fatalf("token: %v (%d)", err, status)
+	}
+	if response.IdToken != "" {
+		t.Fatal("expected no id token without a user")
+	}
+
+	claims, err := helpers.ParseOAuthAccessToken(response.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != client.Id {
+		t.Fatalf("expected the client as subject, got %v", claims["sub"])
+	}
+
+	// there is no user behind the token to describe
+	r = httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+response.AccessToken)
+	if _, err, status = UserInfo(r); err != customizedError.ErrInvalidScope || status != http.StatusForbidden {
+		t.Fatalf("expected userinfo to need the openid scope, got %v (%d)", err, status)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/oauth/token", nil)
+	if _, err, status = Token(r, request.Token{GrantType: "authorization_code", ClientId: client.Id, ClientSecret: testClientSecret}); err != customizedError.ErrUnauthorizedClient {
+		t.Fatalf("expected the unregistered grant to be refused, got %v (%d)", err, status)
+	}
+}
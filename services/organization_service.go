@@ -0,0 +1,492 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+// CreateOrganization creates an organization owned by the calling user.
+func CreateOrganization(
+	r *http.Request,
+	payload request.CreateOrganization,
+) (response responses.OrganizationResponse, err error, status int) {
+	organization := models.Organization{
+		Id:   uuid.New().String(),
+		Name: payload.Name,
+	}
+
+	// created in its own tenant, the policies accept the rows
+	err = db.RunInTenant(r.Context(), organization.Id, func(ctx context.Context) error {
+		return db.TenantDb(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&organization).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.Membership{
+				Id:             uuid.New().String(),
+				OrganizationId: organization.Id,
+				UserId:         middlewares.GetUserId(r.Context()),
+				Role:           models.OrgRoleOwner,
+			}).Error
+		})
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateOrganizationResponse(organization, models.OrgRoleOwner), nil, http.StatusCreated
+}
+
+func GetOrganizations(r *http.Request) (response []responses.OrganizationResponse, err error, status int) {
+	userId := middlewares.GetUserId(r.Context())
+	roles := make(map[string]string)
+
+	var organizations []models.Organization
+	err = db.RunAsUser(r.Context(), userId, func(ctx context.Context) error {
+		var memberships []models.Membership
+
+		if err := db.TenantDb(ctx).Where("user_id = ?", userId).Find(&memberships).Error; err != nil {
+			return err
+		}
+
+		organizationIds := make([]string, 0, len(memberships))
+		for _, membership := range memberships {
+			roles[membership.OrganizationId] = membership.Role
+			organizationIds = append(organizationIds, membership.OrganizationId)
+		}
+
+		if len(organizationIds) == 0 {
+			return nil
+		}
+		return db.TenantDb(ctx).Where("id IN ?", organizationIds).Order("name").Find(&organizations).Error
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.OrganizationResponse, 0, len(organizations))
+	for _, organization := range organizations {
+		response = append(response, responses.GenerateOrganizationResponse(organization, roles[organization.Id]))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+func GetOrganization(r *http.Request) (response responses.OrganizationResponse, err error, status int) {
+	organization := middlewares.GetOrganization(r.Context())
+	membership := middlewares.GetMembership(r.Context())
+
+	return responses.GenerateOrganizationResponse(organization, membership.Role), nil, http.StatusOK
+}
+
+// DeleteOrganization removes the organization along with its memberships
+// and pending invitations.
+func DeleteOrganization(r *http.Request) (message map[string]string, err error, status int) {
+	organization := middlewares.GetOrganization(r.Context())
+
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			err := tx.Where("organization_id = ?", organization.Id).Delete(&models.Invitation{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Where("organization_id = ?", organization.Id).Delete(&models.Membership{}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&organization).Error
+		})
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Organization Deleted"), nil, http.StatusOK
+}
+
+func GetMembers(r *http.Request) (response []responses.MemberResponse, err error, status int) {
+	var memberships []models.Membership
+
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Preload("User").Order("created_at").Find(&memberships).Error
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.MemberResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		response = append(response, responses.GenerateMemberResponse(membership))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+// UpdateMember changes a member's role. Ownership only moves through
+// TransferOwnership.
+func UpdateMember(
+	r *http.Request,
+	payload request.UpdateMember,
+) (response responses.MemberResponse, err error, status int) {
+	if payload.Role != models.OrgRoleAdmin && payload.Role != models.OrgRoleMember {
+		return response, customizedError.ErrInvalidOrgRole, http.StatusUnprocessableEntity
+	}
+
+	member, err, status := findMemberByParam(r)
+	if err != nil {
+		return response, err, status
+	}
+
+	if member.Role == models.OrgRoleOwner {
+		return response, customizedError.ErrInvalidOrgRole, http.StatusUnprocessableEntity
+	}
+
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Model(&member).Update("role", payload.Role).Error
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateMemberResponse(member), nil, http.StatusOK
+}
+
+// RemoveMember removes a member from the organization. Anyone but the
+// owner may remove themselves; removing someone else takes a higher role
+// than theirs.
+func RemoveMember(r *http.Request) (message map[string]string, err error, status int) {
+	member, err, status := findMemberByParam(r)
+	if err != nil {
+		return nil, err, status
+	}
+
+	if member.Role == models.OrgRoleOwner {
+		return nil, customizedError.ErrCantRemoveOwner, http.StatusUnprocessableEntity
+	}
+
+	current := middlewares.GetMembership(r.Context())
+	if member.Id != current.Id && (!current.CanManage() || !current.Outranks(member.Role)) {
+		return nil, customizedError.ErrForbidden, http.StatusForbidden
+	}
+
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Delete(&member).Error
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Member Removed"), nil, http.StatusOK
+}
+
+// TransferOwnership hands the organization to another member. The
+// previous owner stays on as an admin.
+func TransferOwnership(
+	r *http.Request,
+	payload request.TransferOwnership,
+) (message map[string]string, err error, status int) {
+	current := middlewares.GetMembership(r.Context())
+
+	var member models.Membership
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Where("user_id = ?", payload.UserId).First(&member).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, customizedError.ErrMemberNotFound, http.StatusNotFound
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if member.Id == current.Id {
+		return nil, customizedError.ErrInvalidOrgRole, http.StatusUnprocessableEntity
+	}
+
+	// demote first, an organization can only have one owner at a time
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&current).Update("role", models.OrgRoleAdmin).Error; err != nil {
+				return err
+			}
+			return tx.Model(&member).Update("role", models.OrgRoleOwner).Error
+		})
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Ownership Transferred"), nil, http.StatusOK
+}
+
+// InviteMember emails an invitation to join the organization. Inviting an
+// address again replaces its pending invitation.
+func InviteMember(
+	r *http.Request,
+	payload request.InviteMember,
+) (response responses.InvitationResponse, err error, status int) {
+	organization := middlewares.GetOrganization(r.Context())
+	current := middlewares.GetMembership(r.Context())
+
+	if payload.Role == "" {
+		payload.Role = models.OrgRoleMember
+	}
+	if payload.Role != models.OrgRoleAdmin && payload.Role != models.OrgRoleMember || !current.AtLeast(payload.Role) {
+		return response, customizedError.ErrInvalidOrgRole, http.StatusUnprocessableEntity
+	}
+
+	email := strings.ToLower(payload.Email)
+
+	var members int64
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Model(&models.Membership{}).
+			Joins("JOIN users ON users.id = memberships.user_id").
+			Where("LOWER(users.email) = ?", email).
+			Count(&members).Error
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if members != 0 {
+		return response, customizedError.ErrAlreadyMember, http.StatusConflict
+	}
+
+	token, tokenHash, err := helpers.GenerateInvitationToken()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	invitation := models.Invitation{
+		Id:             uuid.New().String(),
+		OrganizationId: organization.Id,
+		Email:          email,
+		Role:           payload.Role,
+		TokenHash:      tokenHash,
+		InvitedBy:      current.UserId,
+		ExpiresAt:      time.Now().Add(helpers.InvitationExpiry),
+	}
+
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			err := tx.Where("email = ?", email).
+				Delete(&models.Invitation{}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Create(&invitation).Error
+		})
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = helpers.SendInvitation(invitation, organization, middlewares.GetUser(r.Context()), token)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateInvitationResponse(invitation, organization), nil, http.StatusCreated
+}
+
+func GetInvitations(r *http.Request) (response []responses.InvitationResponse, err error, status int) {
+	organization := middlewares.GetOrganization(r.Context())
+
+	var invitations []models.Invitation
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Where("expires_at > ?", time.Now()).
+			Order("created_at").
+			Find(&invitations).Error
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		response = append(response, responses.GenerateInvitationResponse(invitation, organization))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+func RevokeInvitation(r *http.Request) (message map[string]string, err error, status int) {
+	var revoked int64
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", chi.URLParam(r, "id")).Delete(&models.Invitation{})
+		revoked = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if revoked == 0 {
+		return nil, customizedError.ErrInvitationNotFound, http.StatusNotFound
+	}
+
+	return helpers.Message("Invitation Revoked"), nil, http.StatusOK
+}
+
+// GetInvitation shows what an emailed invitation is for, so the invitee
+// can decide before signing in.
+func GetInvitation(token string) (response responses.InvitationResponse, err error, status int) {
+	dbErr := db.RunWithInvitation(context.Background(), helpers.HashInvitationToken(token), func(ctx context.Context) error {
+		var invitation models.Invitation
+		var organization models.Organization
+
+		invitation, organization, err, status = findInvitationByToken(ctx, token)
+		if err == nil {
+			response = responses.GenerateInvitationResponse(invitation, organization)
+		}
+		return err
+	})
+	if err == nil && dbErr != nil {
+		return response, helpers.ServerError(dbErr), http.StatusInternalServerError
+	}
+
+	return response, err, status
+}
+
+// AcceptInvitation adds the calling user to the organization. The
+// invitation has to have been sent to their email.
+func AcceptInvitation(
+	r *http.Request,
+	payload request.InvitationToken,
+) (response responses.OrganizationResponse, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	dbErr := db.RunAsUser(r.Context(), user.Id, func(ctx context.Context) error {
+		return db.RunWithInvitation(ctx, helpers.HashInvitationToken(payload.Token), func(ctx context.Context) error {
+			response, err, status = acceptInvitation(ctx, user, payload.Token)
+			return err
+		})
+	})
+	if err == nil && dbErr != nil {
+		return response, helpers.ServerError(dbErr), http.StatusInternalServerError
+	}
+
+	return response, err, status
+}
+
+func acceptInvitation(
+	ctx context.Context,
+	user models.User,
+	token string,
+) (response responses.OrganizationResponse, err error, status int) {
+	invitation, organization, err, status := findInvitationByToken(ctx, token)
+	if err != nil {
+		return response, err, status
+	}
+
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return response, customizedError.ErrInvitationEmailMismatch, http.StatusForbidden
+	}
+
+	// anyone can register with the invited email, only its owner can
+	// verify it
+	if !user.EmailVerified() {
+		return response, customizedError.ErrEmailNotVerified, http.StatusForbidden
+	}
+
+	var members int64
+	err = db.TenantDb(ctx).Model(&models.Membership{}).
+		Where("organization_id = ? AND user_id = ?", organization.Id, user.Id).
+		Count(&members).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if members != 0 {
+		return response, customizedError.ErrAlreadyMember, http.StatusConflict
+	}
+
+	err = db.TenantDb(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&invitation).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{
+			Id:             uuid.New().String(),
+			OrganizationId: organization.Id,
+			UserId:         user.Id,
+			Role:           invitation.Role,
+		}).Error
+	})
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GenerateOrganizationResponse(organization, invitation.Role), nil, http.StatusOK
+}
+
+// DeclineInvitation only needs the emailed token; declining does not
+// require an account.
+func DeclineInvitation(payload request.InvitationToken) (message map[string]string, err error, status int) {
+	dbErr := db.RunWithInvitation(context.Background(), helpers.HashInvitationToken(payload.Token), func(ctx context.Context) error {
+		message, err, status = declineInvitation(ctx, payload.Token)
+		return err
+	})
+	if err == nil && dbErr != nil {
+		return nil, helpers.ServerError(dbErr), http.StatusInternalServerError
+	}
+
+	return message, err, status
+}
+
+func declineInvitation(ctx context.Context, token string) (message map[string]string, err error, status int) {
+	invitation, _, err, status := findInvitationByToken(ctx, token)
+	if err != nil {
+		return nil, err, status
+	}
+
+	if err = db.TenantDb(ctx).Delete(&invitation).Error; err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Invitation Declined"), nil, http.StatusOK
+}
+
+func findMemberByParam(r *http.Request) (member models.Membership, err error, status int) {
+	err = db.InTenant(r.Context(), func(tx *gorm.DB) error {
+		return tx.Preload("User").Where("user_id = ?", chi.URLParam(r, "user")).First(&member).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return member, customizedError.ErrMemberNotFound, http.StatusNotFound
+		}
+		return member, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return member, nil, http.StatusOK
+}
+
+// findInvitationByToken has to run in RunWithInvitation for the token, so
+// the policies show the invitation.
+func findInvitationByToken(
+	ctx context.Context,
+	token string,
+) (invitation models.Invitation, organization models.Organization, err error, status int) {
+	err = db.TenantDb(ctx).Where("token_hash = ?", helpers.HashInvitationToken(token)).First(&invitation).Error
+	if err == nil && !invitation.Expired() {
+		err = db.TenantDb(ctx).Where("id = ?", invitation.OrganizationId).First(&organization).Error
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return invitation, organization, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	if organization.Empty() {
+		return invitation, organization, customizedError.ErrInvalidInvitation, http.StatusNotFound
+	}
+
+	return invitation, organization, nil, http.StatusOK
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+)
+
+// rowLevelSettings records the settings made through set_config. sqlite
+// has no policies, so row level security tests check which settings the
+// queries ran under instead.
+var rowLevelSettings = map[string]string{}
+
+func init() {
+	gosqlite.MustRegisterScalarFunction("set_config", 3, func(_ *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		rowLevelSettings[args[0].(string)] = args[1].(string)
+		return args[1], nil
+	})
+}
+
+func enableRowLevelSecurity(t *testing.T) {
+	t.Helper()
+
+	db.DbConfig.RowLevelSecurity = true
+	clear(rowLevelSettings)
+}
+
+func createTestOrganization(t *testing.T, owner models.User) models.Organization {
+	t.Helper()
+
+	now := time.Now()
+	organization := models.Organization{Id: uuid.New().String(), Name: "Acme", CreatedAt: now, UpdatedAt: now}
+	if err := db.PostDb.Create(&organization).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.PostDb.Create(&models.Membership{
+		Id:             uuid.New().String(),
+		OrganizationId: organization.Id,
+		UserId:         owner.Id,
+		Role:           models.OrgRoleOwner,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return organization
+}
+
+// serveOrganization runs handler behind ResolveOrganization for the user.
+func serveOrganization(t *testing.T, user models.User, organizationId string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := authenticated(t, user.Id, httptest.NewRequest(http.MethodGet, "/orgs/"+organizationId, nil))
+
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("org", organizationId)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+	w := httptest.NewRecorder()
+	middlewares.ResolveOrganization(handler).ServeHTTP(w, r)
+	return w
+}
+
+func TestResolveOrganizationWithRowLevelSecurity(t *testing.T) {
+	setupTestStores(t)
+	enableRowLevelSecurity(t)
+
+	owner := createTestUser(t, "owner@example.com", true)
+	organization := createTestOrganization(t, owner)
+
+	w := serveOrganization(t, owner, organization.Id, func(w http.ResponseWriter, r *http.Request) {
+		if tenantId, _ := db.TenantFromContext(r.Context()); tenantId != organization.Id {
+			t.Fatalf("handler ran in tenant %q", tenantId)
+		}
+		w.Header().Set("X-Organization", middlewares.GetOrganization(r.Context()).Name)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("ok"))
+	})
+	if w.Code != http.StatusAccepted || w.Body.String() != "ok" || w.Header().Get("X-Organization") != "Acme" {
+		t.Fatalf("member got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	if rowLevelSettings["app.tenant_id"] != organization.Id {
+		t.Fatalf("membership looked up under %v", rowLevelSettings)
+	}
+
+	stranger := createTestUser(t, "stranger@example.com", true)
+	w = serveOrganization(t, stranger, organization.Id, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler ran for a non member")
+	})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("non member got %d", w.Code)
+	}
+}
+
+func TestInTenantRollsBackOnErrors(t *testing.T) {
+	setupTestStores(t)
+	enableRowLevelSecurity(t)
+
+	// a deferred foreign key is only checked on commit
+	err := db.PostDb.Exec(`CREATE TABLE projects (id TEXT PRIMARY KEY,
+		organization_id TEXT REFERENCES organizations (id) DEFERRABLE INITIALLY DEFERRED)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := createTestUser(t, "owner@example.com", true)
+	organization := createTestOrganization(t, owner)
+	ctx := db.WithTenant(context.Background(), organization.Id)
+
+	failed := errors.New("handler failed")
+	err = db.InTenant(ctx, func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO projects (id, organization_id) VALUES (?, ?)", uuid.New().String(), organization.Id).Error; err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("InTenant = %v", err)
+	}
+
+	var projects int64
+	db.PostDb.Table("projects").Where("organization_id = ?", organization.Id).Count(&projects)
+	if projects != 0 {
+		t.Fatalf("%d projects written by a failed transaction", projects)
+	}
+
+	if err = db.InTenant(context.Background(), func(tx *gorm.DB) error { return nil }); err == nil {
+		t.Fatal("InTenant ran without a tenant")
+	}
+
+	// last, sqlite keeps the transaction open after a failed commit
+	err = db.InTenant(ctx, func(tx *gorm.DB) error {
+		return tx.Exec("INSERT INTO projects (id, organization_id) VALUES (?, ?)", uuid.New().String(), "missing").Error
+	})
+	if err == nil {
+		t.Fatal("a failed commit was not reported")
+	}
+}
+
+func TestInvitationsWithRowLevelSecurity(t *testing.T) {
+	setupTestStores(t)
+	enableRowLevelSecurity(t)
+
+	owner := createTestUser(t, "owner@example.com", true)
+	created, err, status := CreateOrganization(
+		authenticated(t, owner.Id, httptest.NewRequest(http.MethodPost, "/orgs", nil)),
+		request.CreateOrganization{Name: "Acme"},
+	)
+	if err != nil {
+		t.Fatalf("create = %v, %d", err, status)
+	}
+	if rowLevelSettings["app.tenant_id"] != created.Id {
+		t.Fatalf("organization created under %v", rowLevelSettings)
+	}
+
+	invitee := createTestUser(t, "invitee@example.com", true)
+	token, tokenHash, err := helpers.GenerateInvitationToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.PostDb.Create(&models.Invitation{
+		Id:             uuid.New().String(),
+		OrganizationId: created.Id,
+		Email:          invitee.Email,
+		Role:           models.OrgRoleMember,
+		TokenHash:      tokenHash,
+		InvitedBy:      owner.Id,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clear(rowLevelSettings)
+	if _, err, status = GetInvitation(token); err != nil {
+		t.Fatalf("get invitation = %v, %d", err, status)
+	}
+	if rowLevelSettings["app.invitation_token_hash"] != tokenHash {
+		t.Fatalf("invitation looked up under %v", rowLevelSettings)
+	}
+
+	clear(rowLevelSettings)
+	_, err, status = AcceptInvitation(
+		authenticated(t, invitee.Id, httptest.NewRequest(http.MethodPost, "/invitations/accept", nil)),
+		request.InvitationToken{Token: token},
+	)
+	if err != nil {
+		t.Fatalf("accept = %v, %d", err, status)
+	}
+	if rowLevelSettings["app.user_id"] != invitee.Id || rowLevelSettings["app.invitation_token_hash"] != tokenHash {
+		t.Fatalf("invitation accepted under %v", rowLevelSettings)
+	}
+
+	clear(rowLevelSettings)
+	organizations, err, status := GetOrganizations(
+		authenticated(t, invitee.Id, httptest.NewRequest(http.MethodGet, "/orgs", nil)),
+	)
+	if err != nil || len(organizations) != 1 || organizations[0].Id != created.Id {
+		t.Fatalf("organizations = %v, %v, %d", organizations, err, status)
+	}
+	if rowLevelSettings["app.user_id"] != invitee.Id {
+		t.Fatalf("organizations listed under %v", rowLevelSettings)
+	}
+
+	if _, err, status = DeclineInvitation(request.InvitationToken{Token: token}); status != http.StatusNotFound {
+		t.Fatalf("declining an accepted invitation = %v, %d", err, status)
+	}
+}
+
+func TestTenantScopeIsolatesOrganizations(t *testing.T) {
+	setupTestStores(t)
+
+	owner := createTestUser(t, "owner@example.com", true)
+	other := createTestUser(t, "other@example.com", true)
+	ours := createTestOrganization(t, owner)
+	theirs := createTestOrganization(t, other)
+
+	ctx := db.WithTenant(context.Background(), ours.Id)
+
+	var memberships []models.Membership
+	if err := db.TenantDb(ctx).Find(&memberships).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(memberships) != 1 || memberships[0].OrganizationId != ours.Id {
+		t.Fatalf("tenant query saw %v", memberships)
+	}
+
+	var found models.Organization
+	_ = db.TenantDb(ctx).Where("id = ?", theirs.Id).Find(&found).Error
+	if !found.Empty() {
+		t.Fatal("tenant query saw another organization")
+	}
+
+	// counts go through the row callback
+	var count int64
+	db.TenantDb(ctx).Model(&models.Membership{}).Where("user_id = ?", other.Id).Count(&count)
+	if count != 0 {
+		t.Fatalf("tenant count saw %d memberships of another organization", count)
+	}
+
+	result := db.TenantDb(ctx).Model(&models.Membership{}).Where("user_id = ?", other.Id).Update("role", models.OrgRoleMember)
+	if result.Error != nil || result.RowsAffected != 0 {
+		t.Fatalf("tenant update touched %d rows: %v", result.RowsAffected, result.Error)
+	}
+
+	result = db.TenantDb(ctx).Where("user_id = ?", other.Id).Delete(&models.Membership{})
+	if result.Error != nil || result.RowsAffected != 0 {
+		t.Fatalf("tenant delete touched %d rows: %v", result.RowsAffected, result.Error)
+	}
+
+	var theirOwner models.Membership
+	db.PostDb.Where("organization_id = ?", theirs.Id).First(&theirOwner)
+	if theirOwner.Role != models.OrgRoleOwner {
+		t.Fatalf("other organization's owner is now %q", theirOwner.Role)
+	}
+}
+
+func TestTenantScopeStampsCreates(t *testing.T) {
+	setupTestStores(t)
+
+	owner := createTestUser(t, "owner@example.com", true)
+	organization := createTestOrganization(t, owner)
+
+	invitation := models.Invitation{
+		Id:             uuid.New().String(),
+		OrganizationId: uuid.New().String(),
+		Email:          "invitee@example.com",
+		Role:           models.OrgRoleMember,
+		TokenHash:      "hash",
+		InvitedBy:      owner.Id,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+	if err := db.TenantDb(db.WithTenant(context.Background(), organization.Id)).Create(&invitation).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var stored models.Invitation
+	db.PostDb.Where("id = ?", invitation.Id).First(&stored)
+	if stored.OrganizationId != organization.Id {
+		t.Fatalf("invitation created for %q, not the tenant %q", stored.OrganizationId, organization.Id)
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+const (
+	passkeyRegisterCeremony = "register"
+	passkeyLoginCeremony    = "login"
+)
+
+func GetPasskeys(r *http.Request) (response []responses.PasskeyResponse, err error, status int) {
+	passkeys, err := userPasskeys(middlewares.GetUserId(r.Context()))
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.PasskeyResponse, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		response = append(response, responses.GeneratePasskeyResponse(passkey))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+// BeginPasskeyRegistration asks for a discoverable credential, so the
+// passkey can later sign in without the user typing their email.
+func BeginPasskeyRegistration(r *http.Request) (response responses.PasskeyChallengeResponse, err error, status int) {
+	relyingParty, err := helpers.RelyingParty()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	user := middlewares.GetUser(r.Context())
+	passkeys, err := userPasskeys(user.Id)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	passkeyUser := helpers.PasskeyUser{User: user, Passkeys: passkeys}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(passkeys))
+	for _, credential := range passkeyUser.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, err := relyingParty.BeginRegistration(
+		passkeyUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	challengeId, err := helpers.SavePasskeyChallenge(r.Context(), passkeyRegisterCeremony, session)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GeneratePasskeyRegistrationResponse(challengeId, options), nil, http.StatusOK
+}
+
+func FinishPasskeyRegistration(
+	r *http.Request,
+	payload request.FinishPasskeyRegistration,
+) (response responses.PasskeyResponse, err error, status int) {
+	relyingParty, err := helpers.RelyingParty()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	session, err := helpers.ConsumePasskeyChallenge(r.Context(), passkeyRegisterCeremony, payload.ChallengeId)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidPasskeyChallenge) {
+			return response, err, http.StatusBadRequest
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	user := middlewares.GetUser(r.Context())
+	// the challenge was issued to whoever began the ceremony
+	if !bytes.Equal(session.UserID, []byte(user.Id)) {
+		return response, customizedError.ErrInvalidPasskeyChallenge, http.StatusBadRequest
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(payload.Credential)
+	if err != nil {
+		return response, customizedError.ErrInvalidPasskey, http.StatusBadRequest
+	}
+
+	passkeys, err := userPasskeys(user.Id)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	credential, err := relyingParty.CreateCredential(helpers.PasskeyUser{User: user, Passkeys: passkeys}, session, parsed)
+	if err != nil {
+		return response, customizedError.ErrInvalidPasskey, http.StatusBadRequest
+	}
+
+	passkey := helpers.NewPasskey(user.Id, payload.Name, credential)
+
+	var existing int64
+	err = db.PostDb.Model(&models.Passkey{}).Where("credential_id = ?", passkey.CredentialId).Count(&existing).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if existing != 0 {
+		return response, customizedError.ErrInvalidPasskey, http.StatusConflict
+	}
+
+	if err = db.PostDb.Create(&passkey).Error; err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GeneratePasskeyResponse(passkey), nil, http.StatusCreated
+}
+
+func DeletePasskey(r *http.Request) (message map[string]string, err error, status int) {
+	result := db.PostDb.
+		Where("id = ? AND user_id = ?", chi.URLParam(r, "id"), middlewares.GetUserId(r.Context())).
+		Delete(&models.Passkey{})
+	if result.Error != nil {
+		return nil, helpers.ServerError(result.Error), http.StatusInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return nil, customizedError.ErrPasskeyNotFound, http.StatusNotFound
+	}
+
+	return helpers.Message("Passkey Deleted"), nil, http.StatusOK
+}
+
+// BeginPasskeyLogin starts a discoverable login: no email is asked for,
+// the authenticator offers whichever passkeys it holds for this site.
+func BeginPasskeyLogin(r *http.Request) (response responses.PasskeyChallengeResponse, err error, status int) {
+	relyingParty, err := helpers.RelyingParty()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	options, session, err := relyingParty.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	challengeId, err := helpers.SavePasskeyChallenge(r.Context(), passkeyLoginCeremony, session)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return responses.GeneratePasskeyLoginResponse(challengeId, options), nil, http.StatusOK
+}
+
+// FinishPasskeyLogin verifies the assertion and signs the user in like
+// LoginUser does. A passkey with user verification is already two
+// factors, so no mfa challenge follows it.
+func FinishPasskeyLogin(
+	payload request.FinishPasskeyLogin,
+	device helpers.Device,
+) (response responses.AuthResponse, err error, status int) {
+	ctx := context.Background()
+
+	relyingParty, err := helpers.RelyingParty()
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	session, err := helpers.ConsumePasskeyChallenge(ctx, passkeyLoginCeremony, payload.ChallengeId)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidPasskeyChallenge) {
+			return response, err, http.StatusBadRequest
+		}
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(payload.Credential)
+	if err != nil {
+		return response, customizedError.ErrInvalidPasskey, http.StatusUnauthorized
+	}
+
+	var passkeyUser helpers.PasskeyUser
+	findUser := func(rawId, userHandle []byte) (webauthn.User, error) {
+		err := db.PostDb.Where("id = ?", string(userHandle)).First(&passkeyUser.User).Error
+		if err != nil {
+			return nil, err
+		}
+		passkeyUser.Passkeys, err = userPasskeys(passkeyUser.User.Id)
+		if err != nil {
+			return nil, err
+		}
+		return passkeyUser, nil
+	}
+
+	credential, err := relyingParty.ValidateDiscoverableLogin(findUser, session, parsed)
+	if err != nil {
+		return response, customizedError.ErrInvalidPasskey, http.StatusUnauthorized
+	}
+
+	// a counter that went backwards means the authenticator was cloned
+	if credential.Authenticator.CloneWarning {
+		return response, customizedError.ErrInvalidPasskey, http.StatusUnauthorized
+	}
+
+	user := passkeyUser.User
+
+	err = db.PostDb.Model(&models.Passkey{}).
+		Where("user_id = ? AND credential_id = ?", user.Id, base64.RawURLEncoding.EncodeToString(credential.ID)).
+		Updates(map[string]interface{}{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now(),
+		}).Error
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// a locked account stays locked whatever it signs in with
+	if err = helpers.CheckLoginThrottle(ctx, user.Id, device.IpAddress); err != nil {
+		err, status = loginThrottleError(err)
+		return response, err, status
+	}
+
+	return signIn(user, device, "passkey", false)
+}
+
+func userPasskeys(userId string) (passkeys []models.Passkey, err error) {
+	err = db.PostDb.Where("user_id = ?", userId).Order("created_at").Find(&passkeys).Error
+	return passkeys, err
+}
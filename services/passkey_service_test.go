@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/request"
+)
+
+const (
+	passkeyRpId   = "localhost"
+	passkeyOrigin = "http://localhost:3000"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softAuthenticator is a passkey authenticator in memory: one P-256
+// credential, created with "none" attestation, whose sign count the test
+// sets before each assertion.
+type softAuthenticator struct {
+	credentialId []byte
+	key          *ecdsa.PrivateKey
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialId := make([]byte, 32)
+	if _, err = rand.Read(credentialId); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{credentialId: credentialId, key: key}
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, attested []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(passkeyRpId))
+
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    passkeyOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create answers navigator.credentials.create for options.
+func (a *softAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) json.RawMessage {
+	t.Helper()
+
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // aaguid
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialId)))
+	attested = append(attested, a.credentialId...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(flagUserPresent|flagUserVerified|flagAttested, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData(t, "webauthn.create", options.Response.Challenge)),
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+	})
+}
+
+// get answers navigator.credentials.get for options.
+func (a *softAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion) json.RawMessage {
+	t.Helper()
+
+	authenticatorData := a.authenticatorData(flagUserPresent|flagUserVerified, nil)
+	clientDataJson := clientData(t, "webauthn.get", options.Response.Challenge)
+
+	clientDataHash := sha256.Sum256(clientDataJson)
+	digest := sha256.Sum256(append(authenticatorData, clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJson),
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authenticatorData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) json.RawMessage {
+	t.Helper()
+
+	id := base64.RawURLEncoding.EncodeToString(a.credentialId)
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       id,
+		"rawId":    id,
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func setupPasskeyTest(t *testing.T) {
+	t.Helper()
+
+	setupTestStores(t)
+
+	db.WebAuthnConfig.RPID = passkeyRpId
+	db.WebAuthnConfig.RPOrigins = []string{passkeyOrigin}
+}
+
+// registerPasskey runs the registration ceremony for the user.
+func registerPasskey(t *testing.T, user models.User, authenticator *softAuthenticator) {
+	t.Helper()
+
+	begin, err, status := BeginPasskeyRegistration(
+		authenticated(t, user.Id, httptest.NewRequest(http.MethodPost, "/auth/passkeys/register/begin", nil)),
+	)
+	if err != nil {
+		t.Fatalf("begin registration = %v, %d", err, status)
+	}
+
+	_, err, status = FinishPasskeyRegistration(
+		authenticated(t, user.Id, httptest.NewRequest(http.MethodPost, "/auth/passkeys/register/finish", nil)),
+		request.FinishPasskeyRegistration{
+			ChallengeId: begin.ChallengeId,
+			Name:        "Laptop",
+			Credential:  authenticator.create(t, begin.Options.(*protocol.CredentialCreation)),
+		},
+	)
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("finish registration = %v, %d", err, status)
+	}
+}
+
+// loginWithPasskey runs the login ceremony with the authenticator's
+// current sign count.
+func loginWithPasskey(t *testing.T, authenticator *softAuthenticator) (error, int) {
+	t.Helper()
+
+	begin, err, status := BeginPasskeyLogin(httptest.NewRequest(http.MethodPost, "/auth/passkeys/login/begin", nil))
+	if err != nil {
+		t.Fatalf("begin login = %v, %d", err, status)
+	}
+
+	response, err, status := FinishPasskeyLogin(request.FinishPasskeyLogin{
+		ChallengeId: begin.ChallengeId,
+		Credential:  authenticator.get(t, begin.Options.(*protocol.CredentialAssertion)),
+	}, helpers.Device{IpAddress: "203.0.113.1", UserAgent: "test"})
+	if err == nil && response.Token == "" {
+		t.Fatalf("login answered %d without tokens", status)
+	}
+
+	return err, status
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	setupPasskeyTest(t)
+
+	user := createTestUser(t, "passkey@example.com", true)
+	authenticator := newSoftAuthenticator(t)
+
+	registerPasskey(t, user, authenticator)
+
+	var passkey models.Passkey
+	db.PostDb.Where("user_id = ?", user.Id).First(&passkey)
+	if passkey.CredentialId != base64.RawURLEncoding.EncodeToString(authenticator.credentialId) {
+		t.Fatalf("stored credential %q", passkey.CredentialId)
+	}
+
+	authenticator.signCount = 1
+	if err, status := loginWithPasskey(t, authenticator); err != nil || status != http.StatusOK {
+		t.Fatalf("login = %v, %d", err, status)
+	}
+
+	db.PostDb.Where("id = ?", passkey.Id).First(&passkey)
+	if passkey.SignCount != 1 || passkey.LastUsedAt == nil {
+		t.Fatalf("sign count %d, last used %v", passkey.SignCount, passkey.LastUsedAt)
+	}
+}
+
+func TestPasskeyLoginRejectsClonedAuthenticator(t *testing.T) {
+	setupPasskeyTest(t)
+
+	user := createTestUser(t, "clone@example.com", true)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, user, authenticator)
+
+	authenticator.signCount = 5
+	if err, status := loginWithPasskey(t, authenticator); err != nil {
+		t.Fatalf("login = %v, %d", err, status)
+	}
+
+	// a copy of the key replaying an older counter
+	authenticator.signCount = 5
+	if err, status := loginWithPasskey(t, authenticator); !errors.Is(err, customizedError.ErrInvalidPasskey) || status != http.StatusUnauthorized {
+		t.Fatalf("login with a repeated counter = %v, %d", err, status)
+	}
+
+	authenticator.signCount = 3
+	if err, status := loginWithPasskey(t, authenticator); !errors.Is(err, customizedError.ErrInvalidPasskey) || status != http.StatusUnauthorized {
+		t.Fatalf("login with a lower counter = %v, %d", err, status)
+	}
+}
+
+func TestPasskeyLoginRejectsWrongSignature(t *testing.T) {
+	setupPasskeyTest(t)
+
+	user := createTestUser(t, "forged@example.com", true)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, user, authenticator)
+
+	forger := newSoftAuthenticator(t)
+	forger.credentialId, forger.userHandle, forger.signCount = authenticator.credentialId, authenticator.userHandle, 1
+
+	if err, status := loginWithPasskey(t, forger); !errors.Is(err, customizedError.ErrInvalidPasskey) || status != http.StatusUnauthorized {
+		t.Fatalf("login with another key = %v, %d", err, status)
+	}
+}
+
+func TestPasskeyLoginChecksLikePasswordLogin(t *testing.T) {
+	setupPasskeyTest(t)
+
+	unverified := createTestUser(t, "unverified@example.com", false)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, unverified, authenticator)
+
+	authenticator.signCount = 1
+	if err, status := loginWithPasskey(t, authenticator); !errors.Is(err, customizedError.ErrEmailNotVerified) || status != http.StatusUnauthorized {
+		t.Fatalf("login with an unverified email = %v, %d", err, status)
+	}
+
+	locked := createTestUser(t, "locked@example.com", true)
+	authenticator = newSoftAuthenticator(t)
+	registerPasskey(t, locked, authenticator)
+
+	for i := 0; i < db.AuthConfig.LoginMaxAttempts; i++ {
+		_ = helpers.RecordLoginFailure(context.Background(), &locked, "198.51.100.1")
+	}
+
+	authenticator.signCount = 1
+	if err, status := loginWithPasskey(t, authenticator); !errors.Is(err, customizedError.ErrAccountLocked) || status != http.StatusLocked {
+		t.Fatalf("login to a locked account = %v, %d", err, status)
+	}
+}
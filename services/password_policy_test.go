@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+)
+
+// setPasswordPolicy replaces the PASSWORD_* policy for the test.
+func setPasswordPolicy(t *testing.T, policy db.PasswordEnv) {
+	t.Helper()
+
+	previous := db.PasswordConfig
+	db.PasswordConfig = policy
+	t.Cleanup(func() { db.PasswordConfig = previous })
+}
+
+// policyProblems returns what checkPassword refused the password for,
+// nothing when it was accepted.
+func policyProblems(t *testing.T, password string) []string {
+	t.Helper()
+
+	err, status := checkPassword(password, "Ada Lovelace", "ada.lovelace@example.com")
+	if err == nil {
+		return nil
+	}
+
+	var policyErr helpers.PasswordPolicyError
+	if !errors.As(err, &policyErr) || status != http.StatusUnprocessableEntity {
+		t.Fatalf("checkPassword = %v, %d", err, status)
+	}
+	return policyErr.Problems
+}
+
+func refusedFor(problems []string, problem string) bool {
+	return slices.ContainsFunc(problems, func(p string) bool { return strings.Contains(p, problem) })
+}
+
+func TestPasswordPolicyLength(t *testing.T) {
+	setPasswordPolicy(t, db.PasswordEnv{MinLength: 12})
+
+	if problems := policyProblems(t, "short"); !refusedFor(problems, "At Least 12 Characters") {
+		t.Fatalf("short password refused for %v", problems)
+	}
+
+	// characters are counted, not bytes
+	if problems := policyProblems(t, strings.Repeat("é", 12)); refusedFor(problems, "At Least") {
+		t.Fatalf("12 two byte characters refused for %v", problems)
+	}
+
+	// bcrypt would silently ignore whatever follows the 72nd byte
+	if problems := policyProblems(t, strings.Repeat("é", 36)); refusedFor(problems, "At Most") {
+		t.Fatalf("72 bytes refused for %v", problems)
+	}
+	if problems := policyProblems(t, strings.Repeat("é", 36)+"a"); !refusedFor(problems, "At Most 72 Bytes") {
+		t.Fatalf("73 bytes refused for %v", problems)
+	}
+}
+
+func TestPasswordPolicyRequiredClasses(t *testing.T) {
+	setPasswordPolicy(t, db.PasswordEnv{RequiredClasses: []string{"lower", "upper", "digit", "symbol"}})
+
+	problems := policyProblems(t, "nouppernodigits")
+	for _, class := range []string{"Uppercase", "Digit", "Symbol"} {
+		if !refusedFor(problems, class) {
+			t.Fatalf("missing %s not reported in %v", class, problems)
+		}
+	}
+	if refusedFor(problems, "Lowercase") {
+		t.Fatalf("lowercase reported missing in %v", problems)
+	}
+
+	if problems = policyProblems(t, "Ok1!ÄÖ"); problems != nil {
+		t.Fatalf("password with every class refused for %v", problems)
+	}
+}
+
+func TestPasswordPolicyPersonalWords(t *testing.T) {
+	setPasswordPolicy(t, db.PasswordEnv{})
+
+	for _, password := range []string{"LOVELACE-forever", "my.ada.lovelace.pw"} {
+		if problems := policyProblems(t, password); !refusedFor(problems, "Your Name Or Email") {
+			t.Fatalf("%q refused for %v", password, problems)
+		}
+	}
+
+	if problems := policyProblems(t, "analytical engine notes"); problems != nil {
+		t.Fatalf("unrelated password refused for %v", problems)
+	}
+}
+
+func TestPasswordPolicyStrength(t *testing.T) {
+	setPasswordPolicy(t, db.PasswordEnv{MinStrength: 3})
+
+	for _, password := range []string{"password123", "qwertyuiop", "aaaaaaaaaaaa", "abcdefgh2024"} {
+		if problems := policyProblems(t, password); !refusedFor(problems, "Too Easy To Guess") {
+			t.Fatalf("%q refused for %v", password, problems)
+		}
+	}
+
+	if problems := policyProblems(t, "correct horse battery staple"); problems != nil {
+		t.Fatalf("passphrase refused for %v", problems)
+	}
+}
+
+func TestPasswordPolicyBreachLookup(t *testing.T) {
+	dir := t.TempDir()
+	setPasswordPolicy(t, db.PasswordEnv{BreachedDir: dir})
+
+	breached := "hunter2 is my password"
+	sum := sha1.Sum([]byte(breached))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	// the range files list lower or upper case suffixes with a count
+	contents := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + strings.ToLower(hash[5:]) + ":42\r\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems := policyProblems(t, breached); !refusedFor(problems, "Data Breach") {
+		t.Fatalf("breached password refused for %v", problems)
+	}
+	if problems := policyProblems(t, "not in any list at all"); problems != nil {
+		t.Fatalf("unlisted password refused for %v", problems)
+	}
+
+	// a list that can not be read skips the lookup instead of failing
+	file := filepath.Join(dir, "not-a-directory")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db.PasswordConfig.BreachedDir = file
+	if problems := policyProblems(t, breached); problems != nil {
+		t.Fatalf("unreadable list refused the password for %v", problems)
+	}
+}
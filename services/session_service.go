@@ -0,0 +1,49 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/responses"
+)
+
+func GetSessions(r *http.Request) (response []responses.SessionResponse, err error, status int) {
+	userId := middlewares.GetUserId(r.Context())
+	currentId := middlewares.GetSessionId(r.Context())
+
+	sessions, err := helpers.ListUserSessions(r.Context(), userId)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	response = make([]responses.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, responses.GenerateSessionResponse(session, currentId))
+	}
+
+	return response, nil, http.StatusOK
+}
+
+func DeleteSession(r *http.Request) (message map[string]string, err error, status int) {
+	userId := middlewares.GetUserId(r.Context())
+	sessionId := chi.URLParam(r, "id")
+
+	exists, err := helpers.HasSession(r.Context(), userId, sessionId)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if !exists {
+		return nil, customizedError.ErrSessionNotFound, http.StatusNotFound
+	}
+
+	err = helpers.RevokeTokenFamily(r.Context(), userId, sessionId)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Session Revoked"), nil, http.StatusOK
+}
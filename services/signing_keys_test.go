@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/models"
+)
+
+// signedKid returns the kid a fresh access token is signed with.
+func signedKid(t *testing.T) (string, string) {
+	t.Helper()
+
+	token, err := helpers.GenerateAccessToken(context.Background(), "user-id", helpers.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token.AccessToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return token.AccessToken, kid
+}
+
+func publishedKids() []string {
+	response, _, _ := GetJsonWebKeys()
+
+	kids := make([]string, 0, len(response.Keys))
+	for _, key := range response.Keys {
+		kids = append(kids, key.Kid)
+	}
+	return kids
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	setupTestStores(t)
+	useSigningAlgorithm(t, jwt.SigningMethodEdDSA.Alg())
+
+	oldToken, oldKid := signedKid(t)
+	if oldKid == "" {
+		t.Fatal("expected tokens to name their signing key")
+	}
+
+	rotated, err := helpers.RotateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// published first, so clients with a cached jwks can catch up before
+	// it signs anything
+	if kids := publishedKids(); len(kids) != 2 {
+		t.Fatalf("expected both keys in the jwks, got %v", kids)
+	}
+	if _, kid := signedKid(t); kid != oldKid {
+		t.Fatalf("expected the old key to keep signing until the new one activates, got %s", kid)
+	}
+
+	err = db.PostDb.Model(&models.SigningKey{}).
+		Where("id = ?", rotated.Id).
+		Update("activates_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = helpers.LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, kid := signedKid(t); kid != rotated.Id {
+		t.Fatalf("expected the new key to sign once active, got %s", kid)
+	}
+	if _, err = helpers.ParseClaims(oldToken); err != nil {
+		t.Fatalf("expected tokens signed with the retired key to keep verifying: %v", err)
+	}
+}
+
+func TestSigningKeysAreSealedWithTheAppKey(t *testing.T) {
+	setupTestStores(t)
+	useSigningAlgorithm(t, jwt.SigningMethodRS256.Alg())
+
+	var stored models.SigningKey
+	if err := db.PostDb.First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored.PrivateKey, "sealed:") || strings.Contains(stored.PrivateKey, "PRIVATE KEY") {
+		t.Fatal("expected the private key to be stored sealed")
+	}
+
+	// a copy of the database without the app key can not sign
+	db.AppConfig.AppKey = "another-app-key"
+	if err := helpers.LoadSigningKeys(); err == nil {
+		t.Fatal("expected the keys not to open with another app key")
+	}
+}
+
+func TestAppKeyTokensAfterSwitchingToKeyPairs(t *testing.T) {
+	setupTestStores(t)
+
+	token, kid := signedKid(t)
+	if kid != "" {
+		t.Fatal("expected no kid on tokens signed with the app key")
+	}
+
+	// sessions started before the switch survive it
+	useSigningAlgorithm(t, jwt.SigningMethodEdDSA.Alg())
+	if _, err := helpers.ParseClaims(token); err != nil {
+		t.Fatalf("expected the app key token to verify after the switch: %v", err)
+	}
+
+	// until the last of them has expired
+	err := db.PostDb.Model(&models.SigningKey{}).
+		Where("1 = 1").
+		Update("created_at", time.Now().Add(-helpers.RefreshTokenExpiry-time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = helpers.LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpers.ParseClaims(token); err == nil {
+		t.Fatal("expected app key tokens to be refused once the switch aged out")
+	}
+}
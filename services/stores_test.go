@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/dudeiebot/ad-ly/audit"
+	db "github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/mailer"
+	"github.com/dudeiebot/ad-ly/middlewares"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+)
+
+// setupTestStores points redis, the task queue and postgres at in memory
+// stand ins, with the tables the services under test touch. The returned
+// miniredis lets tests move redis expiries forward.
+func setupTestStores(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	db.Redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = db.Redis.Close() })
+
+	queue.Client = asynq.NewClient(asynq.RedisClientOpt{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = queue.Client.Close() })
+
+	postDb, err := gorm.Open(sqlite.Open("file:"+uuid.New().String()+"?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = postDb.Use(db.TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		`CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT, password TEXT, email TEXT,
+			email_verified_at DATETIME, two_factor_secret TEXT NOT NULL DEFAULT '',
+			two_factor_enabled_at DATETIME, disabled_at DATETIME,
+			created_at DATETIME, updated_at DATETIME, deleted_at DATETIME)`,
+		`CREATE TABLE linked_identities (id TEXT PRIMARY KEY, user_id TEXT, provider TEXT,
+			subject TEXT, email TEXT, created_at DATETIME, updated_at DATETIME,
+			UNIQUE (provider, subject), UNIQUE (user_id, provider))`,
+		`CREATE TABLE passkeys (id TEXT PRIMARY KEY, user_id TEXT, name TEXT,
+			credential_id TEXT UNIQUE, public_key BLOB, attestation_type TEXT, transports TEXT,
+			aaguid BLOB, sign_count INTEGER, backup_eligible BOOLEAN, backup_state BOOLEAN,
+			last_used_at DATETIME, created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE recovery_codes (id TEXT PRIMARY KEY, user_id TEXT, code_hash TEXT,
+			used_at DATETIME, created_at DATETIME)`,
+		`CREATE TABLE api_keys (id TEXT PRIMARY KEY, user_id TEXT, name TEXT, prefix TEXT UNIQUE,
+			secret_hash TEXT, scopes TEXT, expires_at DATETIME, last_used_at DATETIME,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE roles (id TEXT PRIMARY KEY, name TEXT UNIQUE, description TEXT,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE permissions (id TEXT PRIMARY KEY, name TEXT UNIQUE, description TEXT,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE role_permissions (role_id TEXT, permission_id TEXT,
+			PRIMARY KEY (role_id, permission_id))`,
+		`CREATE TABLE user_roles (user_id TEXT, role_id TEXT, created_at DATETIME,
+			PRIMARY KEY (user_id, role_id))`,
+		`CREATE TABLE audit_events (id TEXT PRIMARY KEY, actor_id TEXT, action TEXT,
+			target_type TEXT, target_id TEXT, ip_address TEXT, user_agent TEXT, request_id TEXT,
+			metadata TEXT, created_at DATETIME)`,
+		`CREATE TABLE organizations (id TEXT PRIMARY KEY, name TEXT,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE memberships (id TEXT PRIMARY KEY, organization_id TEXT, user_id TEXT,
+			role TEXT, created_at DATETIME, updated_at DATETIME, UNIQUE (organization_id, user_id))`,
+		`CREATE TABLE invitations (id TEXT PRIMARY KEY, organization_id TEXT, email TEXT,
+			role TEXT, token_hash TEXT UNIQUE, invited_by TEXT, expires_at DATETIME,
+			created_at DATETIME)`,
+		`CREATE TABLE impersonations (id TEXT PRIMARY KEY, actor_id TEXT, user_id TEXT,
+			session_id TEXT, reason TEXT, ip_address TEXT, user_agent TEXT,
+			started_at DATETIME, expires_at DATETIME, ended_at DATETIME)`,
+		`CREATE TABLE signing_keys (id TEXT PRIMARY KEY, algorithm TEXT, private_key TEXT,
+			public_key TEXT, created_at DATETIME, activates_at DATETIME, retired_at DATETIME)`,
+		`CREATE TABLE oauth_clients (id TEXT PRIMARY KEY, name TEXT, secret_hash TEXT,
+			redirect_uris TEXT, grant_types TEXT, scopes TEXT, public BOOLEAN,
+			created_at DATETIME, updated_at DATETIME)`,
+	} {
+		if err = postDb.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.PostDb = postDb
+
+	db.DbConfig.RowLevelSecurity = false
+
+	db.AppConfig.AppName = "ad-ly"
+	db.AppConfig.AppKey = "services-test-app-key"
+	db.AuthConfig.JwtAlgorithm = jwt.SigningMethodHS256.Alg()
+	db.AuthConfig.StatelessTokens = false
+	db.AuthConfig.LoginMaxAttempts = 5
+	db.AuthConfig.LoginLockoutDuration = time.Minute * 15
+	db.AuthConfig.DeletionGracePeriod = time.Hour * 24 * 30
+
+	return mr
+}
+
+// useSigningAlgorithm switches JWT_ALGORITHM and loads the keyring from
+// the test database, creating the first key pair.
+func useSigningAlgorithm(t *testing.T, algorithm string) {
+	t.Helper()
+
+	db.AuthConfig.JwtAlgorithm = algorithm
+	if err := helpers.LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testPassword is the password of every user createTestUser makes.
+const testPassword = "correct horse battery staple"
+
+func createTestUser(t *testing.T, email string, verified bool) models.User {
+	t.Helper()
+
+	password, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	user := models.User{
+		Id:              uuid.New().String(),
+		Name:            "Test User",
+		Password:        string(password),
+		Email:           email,
+		TwoFactorSecret: "secret",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if verified {
+		user.EmailVerifiedAt = &now
+	}
+
+	if err = db.PostDb.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// authenticated signs the user in and passes r through AuthenticateUser,
+// returning the request as a handler behind it would see it.
+func authenticated(t *testing.T, userId string, r *http.Request) *http.Request {
+	t.Helper()
+
+	token, err := helpers.GenerateAccessToken(context.Background(), userId, helpers.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticatedWith(t, token.AccessToken, r)
+}
+
+// authenticatedWith passes r through AuthenticateUser with the access token.
+func authenticatedWith(t *testing.T, accessToken string, r *http.Request) *http.Request {
+	t.Helper()
+
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var seen *http.Request
+	middlewares.AuthenticateUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	})).ServeHTTP(httptest.NewRecorder(), r)
+
+	if seen == nil {
+		t.Fatal("request was not authenticated")
+	}
+	return seen
+}
+
+// pendingTasks returns the payloads of the tasks of the type queued so far.
+func pendingTasks(t *testing.T, taskType string) [][]byte {
+	t.Helper()
+
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: db.Redis.Options().Addr})
+	t.Cleanup(func() { _ = inspector.Close() })
+
+	tasks, err := inspector.ListPendingTasks("default", asynq.PageSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payloads [][]byte
+	for _, task := range tasks {
+		if task.Type == taskType {
+			payloads = append(payloads, task.Payload)
+		}
+	}
+	return payloads
+}
+
+// auditEvents returns the audit events queued so far with the action.
+func auditEvents(t *testing.T, action string) []audit.Event {
+	t.Helper()
+
+	var events []audit.Event
+	for _, payload := range pendingTasks(t, audit.TypeRecordEvent) {
+		var event audit.Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Action == action {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// queuedEmails returns the emails queued so far with the template.
+func queuedEmails(t *testing.T, templateName string) []mailer.EmailPayload {
+	t.Helper()
+
+	var emails []mailer.EmailPayload
+	for _, payload := range pendingTasks(t, "send:email") {
+		var email mailer.EmailPayload
+		if err := json.Unmarshal(payload, &email); err != nil {
+			t.Fatal(err)
+		}
+		if email.TemplateName == templateName {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	"github.com/dudeiebot/ad-ly/helpers"
+)
+
+func TestStatelessTokensOnlyAskTheDenylist(t *testing.T) {
+	mr := setupTestStores(t)
+	db.AuthConfig.StatelessTokens = true
+
+	user := createTestUser(t, "stateless@example.com", true)
+	kept := startTestSession(t, user, homeDevice)
+	token := startTestSession(t, user, unknownDevice)
+
+	// nothing about the token itself is looked up in redis
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "user_auth_") {
+			mr.Del(key)
+		}
+	}
+	if signedInAs(token.AccessToken) != user.Id {
+		t.Fatal("expected the token to verify on its signature alone")
+	}
+
+	r := authenticatedWith(t, token.AccessToken, httptest.NewRequest(http.MethodPost, "/logout", nil))
+	if _, err, status := Logout(r); err != nil {
+		t.Fatalf("logout = %v, %d", err, status)
+	}
+
+	if signedInAs(token.AccessToken) != "" {
+		t.Fatal("expected the signed out token to be denied")
+	}
+	if signedInAs(kept.AccessToken) != user.Id {
+		t.Fatal("expected the other session to stay signed in")
+	}
+}
+
+func TestDisablingAUserDeniesTheirStatelessTokens(t *testing.T) {
+	setupTestStores(t)
+	db.AuthConfig.StatelessTokens = true
+
+	admin := createTestUser(t, "admin@example.com", true)
+	user := createTestUser(t, "user@example.com", true)
+	token := startTestSession(t, user, homeDevice)
+
+	if _, err, status := DisableUser(adminRequest(t, admin, user.Id)); err != nil {
+		t.Fatalf("disable = %v, %d", err, status)
+	}
+
+	// the user is never loaded to notice they are disabled
+	if signedInAs(token.AccessToken) != "" {
+		t.Fatal("expected the disabled user's token to be denied")
+	}
+}
+
+func TestDenyTokens(t *testing.T) {
+	setupTestStores(t)
+	ctx := context.Background()
+
+	if err := helpers.DenyTokens(ctx, "first", "second"); err != nil {
+		t.Fatal(err)
+	}
+
+	for tokenId, expected := range map[string]bool{"first": true, "second": true, "third": false} {
+		denied, err := helpers.IsTokenDenied(ctx, tokenId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if denied != expected {
+			t.Errorf("%s: expected denied = %v", tokenId, expected)
+		}
+	}
+}
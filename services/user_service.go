@@ -1,18 +1,29 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 
 	"github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
 	"github.com/dudeiebot/ad-ly/helpers"
+	"github.com/dudeiebot/ad-ly/jobs"
+	"github.com/dudeiebot/ad-ly/mailer"
 	"github.com/dudeiebot/ad-ly/middlewares"
 	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+	"github.com/dudeiebot/ad-ly/request"
 	"github.com/dudeiebot/ad-ly/responses"
 )
 
 func GetUser(r *http.Request) (response responses.UserResponse, err error, status int) {
 	var user models.User
-	userId := middlewares.GetUser(r.Context()).Id
+	userId := middlewares.GetUserId(r.Context())
 
 	err = config.PostDb.Where("id = ?", userId).Find(&user).Error
 	if err != nil {
@@ -21,3 +32,203 @@ func GetUser(r *http.Request) (response responses.UserResponse, err error, statu
 
 	return responses.GenerateUserResponse(user), nil, http.StatusOK
 }
+
+func GetVerificationStatus(
+	r *http.Request,
+) (response responses.VerificationStatusResponse, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	response.EmailVerified = user.EmailVerified()
+	if response.EmailVerified {
+		verifiedAt := helpers.JSONTime{Time: *user.EmailVerifiedAt}.Json()
+		response.EmailVerifiedAt = &verifiedAt
+		return response, nil, http.StatusOK
+	}
+
+	cooldown, err := helpers.VerificationCooldown(r.Context(), user.Id)
+	if err != nil {
+		return response, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	response.ResendAvailableIn = int64(cooldown.Seconds())
+
+	return response, nil, http.StatusOK
+}
+
+func ChangePassword(
+	r *http.Request,
+	payload request.ChangePassword,
+) (message map[string]string, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.CurrentPassword)); err != nil {
+		return nil, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
+	}
+
+	if err, status = checkPassword(payload.Password, user.Name, user.Email); err != nil {
+		return nil, err, status
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = config.PostDb.Model(&user).Update("password", string(hashedPassword)).Error
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// whoever else might know the old password loses their sessions
+	err = helpers.RevokeOtherSessions(r.Context(), user.Id, middlewares.GetSessionId(r.Context()))
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Password Changed"), nil, http.StatusOK
+}
+
+func ChangeEmail(
+	r *http.Request,
+	payload request.ChangeEmail,
+) (message map[string]string, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
+		return nil, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
+	}
+
+	if payload.Email == user.Email {
+		return nil, customizedError.ErrSameEmail, http.StatusBadRequest
+	}
+
+	// accounts waiting to be purged still own their email until they are gone
+	var existing models.User
+	_ = config.PostDb.Unscoped().Where("email = ?", payload.Email).Find(&existing)
+	if !existing.Empty() {
+		return nil, customizedError.ErrEmaiAlreadyTaken, http.StatusNotAcceptable
+	}
+
+	err = helpers.GenerateEmailChange(r.Context(), &user, payload.Email)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Check Your New Email To Confirm The Change"), nil, http.StatusOK
+}
+
+func ConfirmEmailChange(token string) (message map[string]string, err error, status int) {
+	var user models.User
+
+	change, err := helpers.ConsumeEmailChange(context.Background(), token)
+	if err != nil {
+		if errors.Is(err, customizedError.ErrInvalidEmailChange) {
+			return nil, err, http.StatusNotAcceptable
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = config.PostDb.Where("id = ?", change.UserId).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, customizedError.ErrInvalidEmailChange, http.StatusNotAcceptable
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	// the address could have been registered since the link was sent
+	var existing models.User
+	_ = config.PostDb.Unscoped().Where("email = ?", change.Email).Find(&existing)
+	if !existing.Empty() {
+		return nil, customizedError.ErrEmaiAlreadyTaken, http.StatusNotAcceptable
+	}
+
+	// following the link is what verifies the new address, so the
+	// verification timestamp restarts from now
+	err = config.PostDb.Model(&user).Updates(map[string]interface{}{
+		"email":             change.Email,
+		"email_verified_at": time.Now(),
+	}).Error
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Email Changed"), nil, http.StatusOK
+}
+
+// DeleteUser soft deletes the account and schedules the hard purge for the
+// end of the grace period. Signing in before then restores it.
+func DeleteUser(
+	r *http.Request,
+	payload request.DeleteUser,
+) (message map[string]string, err error, status int) {
+	user := middlewares.GetUser(r.Context())
+	grace := config.AuthConfig.DeletionGracePeriod
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
+		return nil, customizedError.ErrInvalidCredentials, http.StatusUnauthorized
+	}
+
+	// an organization must never be left without an owner
+	var owned int64
+	err = config.RunAsUser(r.Context(), user.Id, func(ctx context.Context) error {
+		return config.TenantDb(ctx).Model(&models.Membership{}).
+			Where("user_id = ? AND role = ?", user.Id, models.OrgRoleOwner).
+			Count(&owned).Error
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+	if owned != 0 {
+		return nil, customizedError.ErrOwnsOrganization, http.StatusConflict
+	}
+
+	// as in DisableUser, the account is only deleted once its tokens are
+	// denylisted
+	err = config.PostDb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", user.Id).Delete(&models.User{}).Error; err != nil {
+			return err
+		}
+		return helpers.RevokeUserTokens(r.Context(), user.Id)
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = jobs.EnqueuePurgeUserTask(queue.Client, jobs.PurgeUserPayload{UserId: user.Id}, grace)
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = mailer.EnqueueEmailTask(queue.Client, mailer.EmailPayload{
+		TemplateName: "account_deleted",
+		To:           user.Email,
+		Subject:      "Your Account Has Been Deleted",
+		Data: map[string]interface{}{
+			"purge_date": time.Now().Add(grace).Format("January 2, 2006"),
+			"Name":       user.Name,
+		},
+	})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Account Deleted"), nil, http.StatusOK
+}
+
+func ExportUser(r *http.Request) (message map[string]string, err error, status int) {
+	userId := middlewares.GetUserId(r.Context())
+
+	if err = helpers.CanRequestDataExport(r.Context(), userId); err != nil {
+		if errors.Is(err, customizedError.ErrCantRequestDataExport) {
+			return nil, err, http.StatusTooManyRequests
+		}
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	err = jobs.EnqueueExportUserTask(queue.Client, jobs.ExportUserPayload{UserId: userId})
+	if err != nil {
+		return nil, helpers.ServerError(err), http.StatusInternalServerError
+	}
+
+	return helpers.Message("Your Export Will Be Emailed To You"), nil, http.StatusAccepted
+}
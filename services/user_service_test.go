@@ -0,0 +1,194 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+
+	db "github.com/dudeiebot/ad-ly/config"
+	customizedError "github.com/dudeiebot/ad-ly/errors"
+	"github.com/dudeiebot/ad-ly/jobs"
+	"github.com/dudeiebot/ad-ly/models"
+	"github.com/dudeiebot/ad-ly/queue"
+	"github.com/dudeiebot/ad-ly/request"
+)
+
+func deleteAccount(t *testing.T, user models.User, accessToken, password string) (error, int) {
+	t.Helper()
+
+	r := authenticatedWith(t, accessToken, httptest.NewRequest(http.MethodDelete, "/user", nil))
+	_, err, status := DeleteUser(r, request.DeleteUser{Password: password})
+	return err, status
+}
+
+// purge runs the purge job for the user the way the worker would.
+func purge(t *testing.T, user models.User) {
+	t.Helper()
+
+	payload, err := json.Marshal(jobs.PurgeUserPayload{UserId: user.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = jobs.HandlePurgeUserTask(context.Background(), asynq.NewTask(jobs.TypePurgeUser, payload)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteUserIsRestoredBySigningIn(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "leaving@example.com", true)
+	token := startTestSession(t, user, homeDevice)
+
+	if err, status := deleteAccount(t, user, token.AccessToken, "wrong password"); status != http.StatusUnauthorized {
+		t.Fatalf("delete with a wrong password = %v, %d", err, status)
+	}
+	if err, status := deleteAccount(t, user, token.AccessToken, testPassword); err != nil {
+		t.Fatalf("delete = %v, %d", err, status)
+	}
+	if signedInAs(token.AccessToken) != "" {
+		t.Fatal("a deleted user's session survived")
+	}
+
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: db.Redis.Options().Addr})
+	t.Cleanup(func() { _ = inspector.Close() })
+	scheduled, err := inspector.ListScheduledTasks("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 1 || scheduled[0].Type != jobs.TypePurgeUser || time.Until(scheduled[0].NextProcessAt) < 29*24*time.Hour {
+		t.Fatalf("scheduled %+v", scheduled)
+	}
+
+	// signing in during the grace period takes the deletion back
+	passwordLogin(t, user, homeDevice)
+	purge(t, user)
+
+	var restored models.User
+	db.PostDb.Where("id = ?", user.Id).Find(&restored)
+	if restored.Empty() {
+		t.Fatal("the account was purged after being restored")
+	}
+}
+
+func TestDeleteUserIsPurgedAfterTheGracePeriod(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "gone@example.com", true)
+	db.PostDb.Create(&models.LinkedIdentity{Id: uuid.New().String(), UserId: user.Id, Provider: "google", Subject: "gone"})
+
+	if err, status := deleteAccount(t, user, startTestSession(t, user, homeDevice).AccessToken, testPassword); err != nil {
+		t.Fatalf("delete = %v, %d", err, status)
+	}
+
+	// the job runs early when the worker was down, nothing is lost
+	purge(t, user)
+	var deleted int64
+	db.PostDb.Unscoped().Model(&models.User{}).Where("id = ?", user.Id).Count(&deleted)
+	if deleted != 1 {
+		t.Fatal("the account was purged inside its grace period")
+	}
+
+	db.PostDb.Unscoped().Model(&models.User{}).Where("id = ?", user.Id).
+		Update("deleted_at", time.Now().Add(-db.AuthConfig.DeletionGracePeriod))
+	_, err, status := LoginUser(request.LoginUser{Email: user.Email, Password: testPassword}, unknownDevice)
+	if !errors.Is(err, customizedError.ErrInvalidCredentials) {
+		t.Fatalf("login after the grace period = %v, %d", err, status)
+	}
+
+	purge(t, user)
+	var left int64
+	db.PostDb.Unscoped().Model(&models.User{}).Where("id = ?", user.Id).Count(&left)
+	if left != 0 {
+		t.Fatal("the account outlived the purge")
+	}
+	db.PostDb.Model(&models.LinkedIdentity{}).Where("user_id = ?", user.Id).Count(&left)
+	if left != 0 {
+		t.Fatal("the linked identity outlived the purge")
+	}
+}
+
+func TestDeleteUserRefusedForOrganizationOwners(t *testing.T) {
+	setupTestStores(t)
+
+	owner := createTestUser(t, "owner@example.com", true)
+	createTestOrganization(t, owner)
+
+	err, status := deleteAccount(t, owner, startTestSession(t, owner, homeDevice).AccessToken, testPassword)
+	if !errors.Is(err, customizedError.ErrOwnsOrganization) || status != http.StatusConflict {
+		t.Fatalf("deleting an owner = %v, %d", err, status)
+	}
+}
+
+func TestExportUserMailsAnArchive(t *testing.T) {
+	setupTestStores(t)
+
+	user := createTestUser(t, "export@example.com", true)
+	token := startTestSession(t, user, homeDevice)
+	db.PostDb.Create(&models.LinkedIdentity{Id: uuid.New().String(), UserId: user.Id, Provider: "google", Subject: "export"})
+
+	export := func() (error, int) {
+		r := authenticatedWith(t, token.AccessToken, httptest.NewRequest(http.MethodPost, "/user/export", nil))
+		_, err, status := ExportUser(r)
+		return err, status
+	}
+	if err, status := export(); err != nil || status != http.StatusAccepted {
+		t.Fatalf("export = %v, %d", err, status)
+	}
+	if err, status := export(); !errors.Is(err, customizedError.ErrCantRequestDataExport) || status != http.StatusTooManyRequests {
+		t.Fatalf("second export = %v, %d", err, status)
+	}
+
+	tasks := pendingTasks(t, jobs.TypeExportUser)
+	if len(tasks) != 1 {
+		t.Fatalf("%d export tasks", len(tasks))
+	}
+	if err := jobs.NewExportUserHandler(queue.Client)(context.Background(), asynq.NewTask(jobs.TypeExportUser, tasks[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := queuedEmails(t, "data_export")
+	if len(emails) != 1 || emails[0].To != user.Email || len(emails[0].Attachments) != 1 {
+		t.Fatalf("export emails = %+v", emails)
+	}
+
+	content := emails[0].Attachments[0].Content
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		files[file.Name] = string(data)
+	}
+
+	if !strings.Contains(files["user.json"], user.Email) || strings.Contains(files["user.json"], user.Password) {
+		t.Fatalf("user.json = %s", files["user.json"])
+	}
+	if strings.Contains(files["user.json"], user.TwoFactorSecret) {
+		t.Fatal("the totp secret was exported")
+	}
+	if !strings.Contains(files["sessions.json"], token.SessionId) {
+		t.Fatalf("sessions.json = %s", files["sessions.json"])
+	}
+	if !strings.Contains(files["linked_identities.json"], "google") {
+		t.Fatalf("linked_identities.json = %s", files["linked_identities.json"])
+	}
+}